@@ -0,0 +1,508 @@
+package logit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ключи служебных полей записи аудита.
+const (
+	auditSeqKey      = "seq"
+	auditPrevHashKey = "prevHash"
+	auditHashKey     = "hash"
+)
+
+// auditHashPrefix отделяет хеш записи от хешируемой части строки.
+const auditHashPrefix = `,"` + auditHashKey + `":"`
+
+// maxAuditTail - сколько байт с конца файла читается при восстановлении цепочки.
+const maxAuditTail = 1 << 20
+
+// AuditConf - настройки журнала аудита.
+type AuditConf struct {
+	// FileName - имя файла относительно LoggerConf.Dir или абсолютный путь.
+	// По умолчанию <appName>_audit.log: имя не зависит от версии и даты,
+	// чтобы цепочка продолжалась между перезапусками.
+	FileName string `yaml:"fileName" json:"fileName"`
+	// Rotation - ротация файла аудита. При nil размер и время ротации берутся из
+	// LoggerConf, а MaxBackups и MaxAge не наследуются: бэкапы аудита не удаляются,
+	// иначе VerifyAudit не сможет проверить начало цепочки.
+	Rotation    *RotationConf    `yaml:"rotation" json:"rotation"`
+	Compression *CompressionConf `yaml:"compression" json:"compression"`
+	// Key - ключ HMAC для хешей записей. Без ключа цепочку может пересчитать любой,
+	// у кого есть доступ на запись к файлам.
+	Key string `yaml:"key" json:"key"`
+}
+
+// Auditor пишет журнал аудита в отдельный файл. Записи не сэмплируются и не
+// отбрасываются: каждая пишется синхронно с fsync, а ошибка возвращается
+// вызывающему. Каждая запись содержит порядковый номер seq, хеш предыдущей
+// записи prevHash и собственный хеш hash, поэтому пропуск, перестановка или
+// изменение записей обнаруживаются VerifyAudit.
+type Auditor struct {
+	mu       sync.Mutex
+	w        *TimeRotatingWriter
+	enc      zapcore.Encoder
+	key      []byte
+	fields   []zap.Field
+	redact   *redactor
+	secrets  *secretRenderer
+	seq      uint64
+	prevHash string
+	torn     bool // файл заканчивается неполной строкой
+}
+
+// MustNewAuditor создает журнал аудита по params.Audit (nil - настройки по умолчанию).
+// Цепочка продолжается с последней записи существующего файла или его последнего
+// бэкапа. Паникует, если конфигурация некорректна или файл не удается прочитать.
+func MustNewAuditor(params *Params) *Auditor {
+	if params == nil || params.AppConf == nil || params.LoggerConf == nil {
+		panic("logger: для журнала аудита нужны params с AppConf и LoggerConf")
+	}
+	conf := params.Audit
+	if conf == nil {
+		conf = &AuditConf{}
+	}
+	// Журнал аудита не шифруется: VerifyAudit читает его как обычный текст.
+	plain := *params
+	plain.Encryption, plain.KeyProvider = nil, nil
+	rotation := conf.Rotation
+	if rotation == nil {
+		inherited := plain.rotation(OutputConf{})
+		inherited.MaxBackups, inherited.MaxAge = 0, 0 // хранить все бэкапы
+		rotation = &inherited
+	}
+	w, err := newFileWriter(&plain, OutputConf{
+		Type:        OutputFile,
+		FileName:    AuditPath(params),
+		Rotation:    rotation,
+		Compression: conf.Compression,
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+	secrets, err := newSecretRenderer(params.Secrets)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	a := &Auditor{
+		w:   w,
+		enc: zapcore.NewJSONEncoder(auditEncoderConfig),
+		key: []byte(conf.Key),
+		fields: []zap.Field{
+			zap.String(appNameKey, params.AppConf.Name),
+			zap.String(appVersionKey, params.AppConf.Version),
+		},
+		secrets: secrets,
+	}
+	if params.Redaction != nil {
+		if a.redact, err = newRedactor(params.Redaction); err != nil {
+			panic(err.Error())
+		}
+	}
+	if err := a.restore(); err != nil {
+		panic(err.Error())
+	}
+	return a
+}
+
+// auditEncoderConfig фиксирует формат записей аудита независимо от настроек выводов.
+var auditEncoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "time",
+	MessageKey:     "action",
+	LineEnding:     "\n",
+	EncodeTime:     utcRFC3339NanoEncoder,
+	EncodeDuration: zapcore.StringDurationEncoder,
+}
+
+// Audit пишет запись о действии action с op и traceId из контекста и полями fields.
+// Возвращает ошибку, если запись не удалось записать и сбросить на диск, а также
+// для полей со служебными именами seq, prevHash, hash и для zap.Namespace: они
+// нарушили бы цепочку хешей.
+func (a *Auditor) Audit(ctx context.Context, action string, fields ...zap.Field) error {
+	if err := checkAuditFields(fields); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seq := a.seq + 1
+	all := make([]zap.Field, 0, len(fields)+6)
+	all = append(all, zap.Uint64(auditSeqKey, seq))
+	if ctx != nil {
+		if op, ok := ctx.Value(opKey).(string); ok {
+			all = append(all, zap.String(string(opKey), op))
+		}
+		if traceID, ok := ctx.Value(traceIDKey).(string); ok {
+			all = append(all, zap.String(string(traceIDKey), traceID))
+		}
+	}
+	all = append(all, a.fields...)
+	fields = a.secrets.fields(fields, false)
+	if a.redact != nil {
+		fields = a.redact.fields(fields)
+		action = a.redact.redactMessage(action)
+	}
+	all = append(all, fields...)
+	all = append(all, zap.String(auditPrevHashKey, a.prevHash))
+
+	buf, err := a.enc.EncodeEntry(zapcore.Entry{Time: time.Now(), Message: action}, all)
+	if err != nil {
+		return fmt.Errorf("logger: кодирование записи аудита: %w", err)
+	}
+	defer buf.Free()
+
+	// Хешируется строка записи без закрывающей скобки; хеш дописывается последним полем.
+	body := bytes.TrimSuffix(buf.Bytes(), []byte("}\n"))
+	sum := auditHash(a.key, body)
+	line := make([]byte, 0, len(body)+len(auditHashPrefix)+len(sum)+4)
+	if a.torn {
+		line = append(line, '\n')
+	}
+	line = append(line, body...)
+	line = append(line, auditHashPrefix...)
+	line = append(line, sum...)
+	line = append(line, "\"}\n"...)
+
+	if _, err := a.w.Write(line); err != nil {
+		a.torn = true // строка могла быть записана частично
+		return fmt.Errorf("logger: запись аудита: %w", err)
+	}
+	a.torn = false
+	a.seq, a.prevHash = seq, sum
+	if err := a.w.Sync(); err != nil {
+		return fmt.Errorf("logger: fsync журнала аудита: %w", err)
+	}
+	return nil
+}
+
+// checkAuditFields отклоняет поля, которые дублируют служебные ключи записи или
+// переносят следующие за ними служебные поля во вложенный объект.
+func checkAuditFields(fields []zap.Field) error {
+	for _, f := range fields {
+		switch {
+		case f.Key == auditSeqKey || f.Key == auditPrevHashKey || f.Key == auditHashKey:
+			return fmt.Errorf("logger: имя поля аудита %q зарезервировано", f.Key)
+		case f.Type == zapcore.NamespaceType:
+			return fmt.Errorf("logger: zap.Namespace (%q) не поддерживается в записях аудита", f.Key)
+		}
+	}
+	return nil
+}
+
+// Close сбрасывает и закрывает файл аудита.
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.w.Close()
+}
+
+// restore находит последнюю запись в текущем файле или в последнем бэкапе.
+func (a *Auditor) restore() error {
+	filename := a.w.Logger.Filename
+	tail, err := fileTail(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("logger: чтение журнала аудита: %w", err)
+	}
+	if len(tail) > 0 && tail[len(tail)-1] != '\n' {
+		a.torn = true
+	}
+	last := lastLine(tail)
+	if last == nil {
+		files, err := auditFiles(filename, a.w.Logger.LocalTime)
+		if err != nil {
+			return fmt.Errorf("logger: поиск бэкапов журнала аудита: %w", err)
+		}
+		// Последний элемент - сам текущий файл, он уже прочитан.
+		for i := len(files) - 2; i >= 0 && last == nil; i-- {
+			if last, err = lastRecordOf(files[i]); err != nil {
+				return fmt.Errorf("logger: чтение бэкапа журнала аудита: %w", err)
+			}
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	rec, err := parseAuditRecord(last)
+	if err != nil {
+		return fmt.Errorf("logger: последняя запись журнала аудита повреждена: %w", err)
+	}
+	a.seq, a.prevHash = rec.Seq, rec.hash
+	return nil
+}
+
+// auditHash возвращает hex SHA-256 (HMAC-SHA256 при заданном ключе) от body.
+func auditHash(key, body []byte) string {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditRecord - служебные поля записи аудита.
+type auditRecord struct {
+	Seq      uint64 `json:"seq"`
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+
+	body []byte // хешируемая часть строки
+	hash string
+}
+
+// parseAuditRecord разбирает строку записи и выделяет хешируемую часть.
+func parseAuditRecord(line []byte) (auditRecord, error) {
+	var rec auditRecord
+	i := bytes.LastIndex(line, []byte(auditHashPrefix))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return rec, errors.New("нет поля hash")
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return rec, err
+	}
+	rec.body = line[:i]
+	rec.hash = string(line[i+len(auditHashPrefix) : len(line)-2])
+	if rec.hash != rec.Hash {
+		return rec, errors.New("поле hash не последнее в записи")
+	}
+	return rec, nil
+}
+
+// fileTail читает не более maxAuditTail последних байт файла.
+func fileTail(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxAuditTail
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+// lastLine возвращает последнюю полную непустую строку data без '\n'.
+func lastLine(data []byte) []byte {
+	end := bytes.LastIndexByte(data, '\n')
+	for end > 0 {
+		start := bytes.LastIndexByte(data[:end], '\n') + 1
+		if line := bytes.TrimSpace(data[start:end]); len(line) > 0 {
+			return line
+		}
+		end = start - 1
+	}
+	return nil
+}
+
+// lastRecordOf возвращает последнюю полную строку файла, в том числе сжатого.
+func lastRecordOf(path string) ([]byte, error) {
+	r, err := OpenLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var last []byte
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == nil {
+			if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+				last = trimmed
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return last, nil
+		}
+		return nil, err
+	}
+}
+
+// auditFiles возвращает бэкапы журнала (сжатые и нет) от старых к новым и
+// последним элементом - текущий файл.
+func auditFiles(filename string, local bool) ([]string, error) {
+	seen := make(map[time.Time]bool)
+	var backups []backupFile
+	for _, suffix := range append([]string{""}, compressorExts()...) {
+		found, err := listBackups(filename, suffix, local)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, b := range found {
+			// Во время сжатия бэкап недолго существует в обоих видах.
+			if !seen[b.timestamp] {
+				seen[b.timestamp] = true
+				backups = append(backups, b)
+			}
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].timestamp.Before(backups[j].timestamp) })
+	files := make([]string, 0, len(backups)+1)
+	for _, b := range backups {
+		files = append(files, b.path)
+	}
+	return append(files, filename), nil
+}
+
+// compressorExts возвращает расширения известных форматов сжатия.
+func compressorExts() []string {
+	exts := make([]string, 0, len(compressors))
+	for _, c := range compressors {
+		exts = append(exts, c.Ext())
+	}
+	return exts
+}
+
+// AuditReport - результат проверки журнала аудита.
+type AuditReport struct {
+	Files    []string // проверенные файлы от старых к новым
+	Records  int
+	FirstSeq uint64 // 0, если журнал пуст
+	LastSeq  uint64
+}
+
+// AuditError описывает первое нарушение цепочки.
+type AuditError struct {
+	File   string
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("logger: журнал аудита %s:%d (seq %d): %s", e.File, e.Line, e.Seq, e.Reason)
+}
+
+// VerifyAudit проверяет цепочку журнала аудита filename вместе с ротированными и
+// сжатыми бэкапами: хеш каждой записи, непрерывность seq и совпадение prevHash
+// с хешем предыдущей записи. key - ключ HMAC из AuditConf.Key. Первое нарушение
+// возвращается как *AuditError, в том числе если журнал начинается не с seq 1:
+// начальные записи или бэкапы удалены. Для журналов, часть которых удалена
+// намеренно, используйте VerifyAuditFrom.
+func VerifyAudit(filename, key string, localTime bool) (AuditReport, error) {
+	return VerifyAuditFrom(filename, key, localTime, 1)
+}
+
+// VerifyAuditFrom проверяет журнал как VerifyAudit, но ожидает, что первая
+// сохранившаяся запись имеет номер firstSeq. firstSeq хранится вне журнала,
+// например, как AuditReport.LastSeq+1 на момент архивации удаленных бэкапов.
+func VerifyAuditFrom(filename, key string, localTime bool, firstSeq uint64) (AuditReport, error) {
+	var report AuditReport
+	files, err := auditFiles(filename, localTime)
+	if err != nil {
+		return report, err
+	}
+
+	var prev *auditRecord
+	for _, path := range files {
+		r, err := OpenLogFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == filename {
+				continue // текущий файл еще не создан после ротации
+			}
+			return report, err
+		}
+		report.Files = append(report.Files, path)
+		err = verifyAuditFile(path, r, []byte(key), firstSeq, &prev, &report)
+		_ = r.Close()
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func verifyAuditFile(path string, r io.Reader, key []byte, firstSeq uint64, prev **auditRecord, report *AuditReport) error {
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if err := verifyAuditRecord(path, lineNo, trimmed, key, firstSeq, prev, report); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func verifyAuditRecord(path string, lineNo int, line, key []byte, firstSeq uint64, prev **auditRecord, report *AuditReport) error {
+	fail := func(seq uint64, reason string, args ...any) error {
+		return &AuditError{File: path, Line: lineNo, Seq: seq, Reason: fmt.Sprintf(reason, args...)}
+	}
+	rec, err := parseAuditRecord(line)
+	if err != nil {
+		return fail(0, "запись не разбирается: %v", err)
+	}
+	if auditHash(key, rec.body) != rec.hash {
+		return fail(rec.Seq, "хеш не совпадает: запись изменена")
+	}
+	switch {
+	case *prev == nil:
+		if rec.Seq != firstSeq {
+			return fail(rec.Seq, "ожидался seq %d: начало журнала отсутствует", firstSeq)
+		}
+		if rec.Seq == 1 && rec.PrevHash != "" {
+			return fail(rec.Seq, "первая запись ссылается на предыдущую")
+		}
+		report.FirstSeq = rec.Seq
+	case rec.Seq != (*prev).Seq+1:
+		return fail(rec.Seq, "ожидался seq %d: записи пропущены или переставлены", (*prev).Seq+1)
+	case rec.PrevHash != (*prev).hash:
+		return fail(rec.Seq, "prevHash не совпадает с хешем записи %d", (*prev).Seq)
+	}
+	report.Records++
+	report.LastSeq = rec.Seq
+	*prev = &rec
+	return nil
+}
+
+// AuditPath возвращает путь файла аудита для params - тот же, что использует
+// MustNewAuditor. Нужен для VerifyAudit в инструментах с той же конфигурацией.
+func AuditPath(params *Params) string {
+	name := strings.ReplaceAll(params.AppConf.Name, "/", "_") + "_audit.log"
+	if params.Audit != nil && params.Audit.FileName != "" {
+		name = params.Audit.FileName
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(params.LoggerConf.Dir, name)
+}
@@ -0,0 +1,212 @@
+package logit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/x3a-tech/configo"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAuditTestParams(t *testing.T, logger *configo.Logger, audit *AuditConf) *Params {
+	t.Helper()
+	logger.Dir = t.TempDir()
+	return &Params{
+		AppConf:    &configo.App{Name: "app", Version: "1"},
+		LoggerConf: logger,
+		Audit:      audit,
+	}
+}
+
+// writeAuditRecords пишет n записей; при ротации по времени между записями
+// выдерживается пауза, чтобы имена бэкапов (с точностью до миллисекунды) различались.
+func writeAuditRecords(t *testing.T, params *Params, n int) {
+	t.Helper()
+	a := MustNewAuditor(params)
+	for i := 1; i <= n; i++ {
+		if err := a.Audit(context.Background(), "action", zap.Int("n", i)); err != nil {
+			t.Fatalf("Audit: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// editAuditLines заменяет строки текущего файла аудита результатом edit.
+func editAuditLines(t *testing.T, path string, edit func(lines []string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\n")
+	}
+	out := strings.Join(edit(lines), "\n") + "\n"
+	if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditRejectsReservedFields(t *testing.T) {
+	params := &Params{
+		AppConf:    &configo.App{Name: "app", Version: "1"},
+		LoggerConf: &configo.Logger{Dir: t.TempDir()},
+		Audit:      &AuditConf{Key: "k"},
+	}
+	a := MustNewAuditor(params)
+	defer a.Close()
+	ctx := context.Background()
+
+	if err := a.Audit(ctx, "first", zap.Int("userId", 1)); err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+	rejected := map[string]zap.Field{
+		"seq":       zap.Uint64("seq", 100),
+		"prevHash":  zap.String("prevHash", "00"),
+		"hash":      zap.String("hash", "00"),
+		"namespace": zap.Namespace("details"),
+	}
+	for name, f := range rejected {
+		if err := a.Audit(ctx, "bad", zap.Int("userId", 1), f); err == nil {
+			t.Errorf("%s: запись с полем %q принята", name, f.Key)
+		}
+	}
+	if err := a.Audit(ctx, "second", zap.String("role", "admin")); err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+
+	report, err := VerifyAudit(AuditPath(params), "k", false)
+	if err != nil {
+		t.Fatalf("VerifyAudit: %v", err)
+	}
+	if report.Records != 2 || report.LastSeq != 2 {
+		t.Errorf("записей %d, последний seq %d, ожидалось 2 и 2", report.Records, report.LastSeq)
+	}
+}
+
+func TestVerifyAuditDetectsTampering(t *testing.T) {
+	cases := map[string]struct {
+		edit func(lines []string) []string
+		seq  uint64
+	}{
+		"modified": {func(l []string) []string {
+			l[1] = strings.Replace(l[1], `"n":2`, `"n":20`, 1)
+			return l
+		}, 2},
+		"deleted": {func(l []string) []string {
+			return append(l[:1], l[2:]...)
+		}, 3},
+		"reordered": {func(l []string) []string {
+			l[1], l[2] = l[2], l[1]
+			return l
+		}, 3},
+		"head deleted": {func(l []string) []string {
+			return l[1:]
+		}, 2},
+		"hash recomputed without key": {func(l []string) []string {
+			rec, _ := parseAuditRecord([]byte(l[1]))
+			body := bytes.Replace(rec.body, []byte(`"n":2`), []byte(`"n":20`), 1)
+			l[1] = string(body) + auditHashPrefix + auditHash(nil, body) + `"}`
+			return l
+		}, 2},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			params := newAuditTestParams(t, &configo.Logger{}, &AuditConf{Key: "k"})
+			writeAuditRecords(t, params, 4)
+			path := AuditPath(params)
+			if _, err := VerifyAudit(path, "k", false); err != nil {
+				t.Fatalf("VerifyAudit до изменения: %v", err)
+			}
+
+			editAuditLines(t, path, tc.edit)
+			_, err := VerifyAudit(path, "k", false)
+			var auditErr *AuditError
+			if !errors.As(err, &auditErr) {
+				t.Fatalf("VerifyAudit: %v, ожидалась *AuditError", err)
+			}
+			if auditErr.Seq != tc.seq {
+				t.Errorf("нарушение у seq %d, ожидалось %d: %v", auditErr.Seq, tc.seq, err)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditFromKnownFirstSeq(t *testing.T) {
+	params := newAuditTestParams(t, &configo.Logger{}, &AuditConf{Key: "k"})
+	writeAuditRecords(t, params, 3)
+	path := AuditPath(params)
+	editAuditLines(t, path, func(l []string) []string { return l[1:] })
+
+	report, err := VerifyAuditFrom(path, "k", false, 2)
+	if err != nil {
+		t.Fatalf("VerifyAuditFrom: %v", err)
+	}
+	if report.FirstSeq != 2 || report.LastSeq != 3 || report.Records != 2 {
+		t.Errorf("отчет %+v, ожидались seq 2..3", report)
+	}
+	if _, err := VerifyAuditFrom(path, "k", false, 1); err == nil {
+		t.Error("VerifyAuditFrom с firstSeq 1 принял журнал без первой записи")
+	}
+}
+
+func TestVerifyAuditAcrossRotatedBackups(t *testing.T) {
+	for name, compression := range map[string]*CompressionConf{"plain": nil, "gzip": {Algorithm: "gzip"}} {
+		t.Run(name, func(t *testing.T) {
+			params := newAuditTestParams(t, &configo.Logger{}, &AuditConf{
+				Key:         "k",
+				Rotation:    &RotationConf{RotationTime: "1ns"}, // ротация перед каждой записью
+				Compression: compression,
+			})
+			writeAuditRecords(t, params, 4)
+			path := AuditPath(params)
+
+			report, err := VerifyAudit(path, "k", false)
+			if err != nil {
+				t.Fatalf("VerifyAudit: %v", err)
+			}
+			if report.Records != 4 || report.FirstSeq != 1 || report.LastSeq != 4 || len(report.Files) < 4 {
+				t.Fatalf("отчет %+v, ожидались 4 записи в отдельных файлах", report)
+			}
+			if compression != nil && !strings.HasSuffix(report.Files[0], ".gz") {
+				t.Errorf("бэкап %s не сжат", report.Files[0])
+			}
+
+			// Удаленный бэкап в середине - пропуск записей.
+			if err := os.Remove(report.Files[1]); err != nil {
+				t.Fatal(err)
+			}
+			var auditErr *AuditError
+			if _, err := VerifyAudit(path, "k", false); !errors.As(err, &auditErr) || auditErr.Seq != 3 {
+				t.Errorf("VerifyAudit после удаления бэкапа: %v, ожидалось нарушение у seq 3", err)
+			}
+		})
+	}
+}
+
+func TestAuditKeepsBackupsDespiteLoggerRetention(t *testing.T) {
+	params := newAuditTestParams(t, &configo.Logger{MaxBackups: 1, MaxAge: 1, RotationTime: "1ns"}, &AuditConf{Key: "k"})
+	a := MustNewAuditor(params)
+	if a.w.Logger.MaxBackups != 0 || a.w.Logger.MaxAge != 0 {
+		t.Errorf("MaxBackups=%d MaxAge=%d, ожидалось хранение всех бэкапов", a.w.Logger.MaxBackups, a.w.Logger.MaxAge)
+	}
+	_ = a.Close()
+
+	writeAuditRecords(t, params, 4)
+	matches, _ := filepath.Glob(filepath.Join(params.LoggerConf.Dir, "app_audit-*"))
+	if len(matches) < 3 {
+		t.Errorf("бэкапов %d, ожидалось не меньше 3", len(matches))
+	}
+	if report, err := VerifyAudit(AuditPath(params), "k", false); err != nil || report.Records != 4 {
+		t.Errorf("VerifyAudit: %+v, %v", report, err)
+	}
+}
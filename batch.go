@@ -0,0 +1,531 @@
+package logit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Параметры пакетной отправки по умолчанию.
+const (
+	defaultBatchEntries  = 1000
+	defaultBatchBytes    = 1 << 20
+	defaultBatchInterval = time.Second
+	defaultQueueBytes    = 16 << 20
+	defaultBatchRetries  = 5
+	defaultBatchTimeout  = 10 * time.Second
+)
+
+// BatchConf задает пакетную отправку записей в удаленный приемник. Записи
+// копятся в очереди ограниченного размера и отправляются фоновой горутиной.
+type BatchConf struct {
+	MaxEntries int           `yaml:"maxEntries" json:"maxEntries"` // записей в пакете; по умолчанию 1000
+	MaxBytes   int           `yaml:"maxBytes" json:"maxBytes"`     // байт в пакете; по умолчанию 1 МБ
+	Interval   time.Duration `yaml:"interval" json:"interval"`     // максимальная задержка отправки; по умолчанию 1s
+	// QueueBytes ограничивает память под неотправленные записи; по умолчанию 16 МБ.
+	// Записи сверх лимита отбрасываются.
+	QueueBytes int `yaml:"queueBytes" json:"queueBytes"`
+	// MaxRetries - повторы отправки пакета после ошибки; по умолчанию 5, -1 - без повторов.
+	MaxRetries int           `yaml:"maxRetries" json:"maxRetries"`
+	MinBackoff time.Duration `yaml:"minBackoff" json:"minBackoff"` // по умолчанию 0.5s
+	MaxBackoff time.Duration `yaml:"maxBackoff" json:"maxBackoff"` // по умолчанию 30s
+	Timeout    time.Duration `yaml:"timeout" json:"timeout"`       // таймаут одной отправки и Sync; по умолчанию 10s
+}
+
+// withDefaults возвращает конфигурацию с заполненными значениями по умолчанию.
+func (c *BatchConf) withDefaults() BatchConf {
+	var conf BatchConf
+	if c != nil {
+		conf = *c
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = defaultBatchEntries
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = defaultBatchBytes
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = defaultBatchInterval
+	}
+	if conf.QueueBytes <= 0 {
+		conf.QueueBytes = defaultQueueBytes
+	}
+	if conf.QueueBytes < conf.MaxBytes {
+		conf.QueueBytes = conf.MaxBytes
+	}
+	switch {
+	case conf.MaxRetries == 0:
+		conf.MaxRetries = defaultBatchRetries
+	case conf.MaxRetries < 0:
+		conf.MaxRetries = 0
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultBatchTimeout
+	}
+	return conf
+}
+
+// QueueStats - состояние очереди удаленного вывода, см. Stats.
+type QueueStats struct {
+	Name    string // приемник, как в сообщениях об ошибках
+	Entries int    // записей в очереди, включая отправляемый пакет
+	Bytes   int    // размер этих записей
+	Dropped int64  // записей отброшено с момента создания логгера
+	// SpoolBytes - место, занятое спулом на диске; 0, если спул не используется.
+	SpoolBytes int64
+}
+
+var errQueueFull = errors.New("очередь переполнена")
+
+// remoteEntry - закодированная запись для удаленного приемника. key группирует
+// записи внутри пакета: набор меток Loki, индекс Elasticsearch, тег Fluent и т.п.
+type remoteEntry struct {
+	key  string
+	time time.Time
+	data []byte
+}
+
+// permanentError - ошибка отправки, которую бессмысленно повторять
+// (например, 400 Bad Request): пакет сразу считается неотправленным.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// partialError - часть пакета не принята приемником; повторно отправляются
+// только entries.
+type partialError struct {
+	entries []remoteEntry
+	err     error
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+
+func (e *partialError) Unwrap() error { return e.err }
+
+// retryDelayer реализуют ошибки, для которых приемник указал паузу перед
+// повтором (Retry-After).
+type retryDelayer interface {
+	retryDelay() time.Duration
+}
+
+// batcher копит записи в ограниченной очереди и отправляет их пакетами
+// в фоновой горутине с повторами и растущей паузой. Пакеты, которые так и не
+// удалось отправить, передаются fallback (если задан) или отбрасываются.
+type batcher struct {
+	conf     BatchConf
+	name     string // приемник в сообщениях об ошибках
+	send     func(ctx context.Context, batch []remoteEntry) error
+	fallback func(batch []remoteEntry) error
+	onError  func(error)
+	spool    *spool // дисковая очередь вместо queue, см. startSpool
+	// closers освобождают ресурсы отправителя (соединение, запасной файл)
+	// после остановки фоновой горутины, см. close.
+	closers []func() error
+
+	ctx       context.Context // отменяется при close
+	cancel    context.CancelFunc
+	stopped   chan struct{} // закрывается при выходе из run
+	closeOnce sync.Once
+	closeErr  error
+
+	mu       sync.Mutex
+	queue    []remoteEntry
+	entries  int           // записей в очереди и отправляемом пакете
+	bytes    int           // размер очереди и отправляемого пакета
+	drained  chan struct{} // закрывается, когда очередь опустеет после запроса Sync
+	flushNow bool
+	down     bool // о недоступности приемника уже сообщено
+	overflow bool // о переполнении очереди уже сообщено
+	wake     chan struct{}
+
+	dropped atomic.Int64
+}
+
+func newBatcher(name string, conf *BatchConf, send func(context.Context, []remoteEntry) error, onError func(error)) *batcher {
+	b := &batcher{
+		conf:    conf.withDefaults(),
+		name:    name,
+		send:    send,
+		onError: onError,
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// add ставит запись в очередь. Если очередь заполнена, запись отбрасывается.
+func (b *batcher) add(e remoteEntry) {
+	b.mu.Lock()
+	var err error
+	switch {
+	case b.spool != nil:
+		err = b.spool.append(e)
+	case b.bytes+len(e.data) > b.conf.QueueBytes:
+		err = errQueueFull
+	}
+	if err != nil {
+		// О переполнении сообщается один раз, об отвергнутой записи - каждый раз.
+		rejected := errors.Is(err, errSpoolKeyTooLong)
+		report := rejected || !b.overflow
+		if !rejected {
+			b.overflow = true
+		}
+		b.mu.Unlock()
+		b.dropped.Add(1)
+		if report {
+			b.onError(fmt.Errorf("logger: %s: записи отбрасываются: %w", b.name, err))
+		}
+		return
+	}
+	if b.spool == nil {
+		b.queue = append(b.queue, e)
+	}
+	b.entries++
+	b.bytes += len(e.data)
+	full := len(b.queue) >= b.conf.MaxEntries || b.bytes >= b.conf.MaxBytes
+	b.mu.Unlock()
+	if full {
+		b.signal()
+	}
+}
+
+func (b *batcher) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush отправляет накопленные записи и ждет их доставки не дольше Timeout.
+// Со спулом записи уже на диске: flush сбрасывает сегмент и не ждет
+// недоступный приемник.
+func (b *batcher) flush() error {
+	b.mu.Lock()
+	spooled := b.spool != nil
+	if spooled {
+		if err := b.spool.sync(); err != nil {
+			b.mu.Unlock()
+			return fmt.Errorf("logger: %s: %w", b.name, err)
+		}
+	}
+	if b.entries == 0 || spooled && b.down {
+		b.mu.Unlock()
+		return nil
+	}
+	if b.drained == nil {
+		b.drained = make(chan struct{})
+	}
+	drained := b.drained
+	b.flushNow = true
+	b.mu.Unlock()
+	b.signal()
+
+	timer := time.NewTimer(b.conf.Timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return nil
+	case <-timer.C:
+		if spooled {
+			return nil
+		}
+		return fmt.Errorf("logger: %s: записи не отправлены за %s", b.name, b.conf.Timeout)
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.stopped)
+	timer := time.NewTimer(b.conf.Interval)
+	defer timer.Stop()
+	for {
+		stopping := false
+		select {
+		case <-b.wake:
+		case <-timer.C:
+			timer.Reset(b.conf.Interval)
+			b.mu.Lock()
+			b.flushNow = true
+			b.mu.Unlock()
+		case <-b.ctx.Done():
+			// Записи спула дождутся следующего запуска, записи в памяти передаются
+			// запасному выводу или отбрасываются с ошибкой.
+			if b.spool != nil {
+				return
+			}
+			stopping = true
+			b.mu.Lock()
+			b.flushNow = true
+			b.mu.Unlock()
+		}
+		for {
+			batch, size, err := b.next()
+			if err != nil {
+				b.onError(err)
+			}
+			if batch == nil {
+				break
+			}
+			if !b.deliver(batch) {
+				return
+			}
+			if err := b.done(len(batch), size); err != nil {
+				b.onError(err)
+			}
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+// next забирает из очереди пакет, если он заполнен или запрошена отправка.
+func (b *batcher) next() ([]remoteEntry, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries == 0 {
+		b.flushNow = false
+		return nil, 0, nil
+	}
+	if b.spool != nil {
+		if !b.flushNow && b.entries < b.conf.MaxEntries && b.bytes < b.conf.MaxBytes {
+			return nil, 0, nil
+		}
+		batch, err := b.spool.read(b.conf.MaxEntries, b.conf.MaxBytes)
+		size := 0
+		for _, e := range batch {
+			size += len(e.data)
+		}
+		return batch, size, err
+	}
+	n, size := 0, 0
+	for n < len(b.queue) && n < b.conf.MaxEntries {
+		if n > 0 && size+len(b.queue[n].data) > b.conf.MaxBytes {
+			break
+		}
+		size += len(b.queue[n].data)
+		n++
+	}
+	if n == len(b.queue) && !b.flushNow && n < b.conf.MaxEntries && size < b.conf.MaxBytes {
+		return nil, 0, nil // пакет не заполнен, ждем таймера
+	}
+	batch := make([]remoteEntry, n)
+	copy(batch, b.queue)
+	clear(b.queue[:n])
+	b.queue = b.queue[n:]
+	if len(b.queue) == 0 {
+		b.queue = nil
+	}
+	return batch, size, nil
+}
+
+// done освобождает место в очереди после обработки пакета.
+func (b *batcher) done(entries, size int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries -= entries
+	b.bytes -= size
+	var err error
+	if b.spool != nil {
+		err = b.spool.commit()
+		b.overflow = false
+	}
+	if b.entries == 0 {
+		b.overflow = false
+		if b.drained != nil {
+			close(b.drained)
+			b.drained = nil
+		}
+	}
+	return err
+}
+
+// deliver отправляет пакет с повторами. Пауза между попытками растет, если
+// приемник не указал ее сам. Возвращает false, если batcher закрыт, а пакет
+// остался в спуле и не должен подтверждаться.
+func (b *batcher) deliver(batch []remoteEntry) bool {
+	bo := newBackoff(b.conf.MinBackoff, b.conf.MaxBackoff)
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(b.ctx, b.conf.Timeout)
+		err := b.send(ctx, batch)
+		cancel()
+		if err == nil {
+			b.setDown(false, nil)
+			return true
+		}
+
+		var partial *partialError
+		if errors.As(err, &partial) {
+			batch = partial.entries
+		}
+		if b.ctx.Err() != nil {
+			if b.spool != nil {
+				return false
+			}
+			b.failed(batch, fmt.Errorf("логгер закрыт: %w", err))
+			return true
+		}
+		var permanent *permanentError
+		// Со спулом записи ждут восстановления приемника на диске.
+		if errors.As(err, &permanent) || b.spool == nil && attempt >= b.conf.MaxRetries {
+			b.failed(batch, err)
+			return true
+		}
+		b.setDown(true, err)
+
+		delay := bo.next()
+		var delayer retryDelayer
+		if errors.As(err, &delayer) && delayer.retryDelay() > 0 {
+			delay = delayer.retryDelay()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// close останавливает фоновую горутину и освобождает ресурсы отправителя.
+// Записи, оставшиеся в памяти, передаются запасному выводу или отбрасываются;
+// записи спула отправятся при следующем запуске.
+func (b *batcher) close() error {
+	b.closeOnce.Do(func() {
+		b.cancel()
+		<-b.stopped
+		var errs []error
+		for _, c := range b.closers {
+			errs = append(errs, c())
+		}
+		b.mu.Lock()
+		if b.spool != nil {
+			errs = append(errs, b.spool.close())
+		}
+		b.mu.Unlock()
+		b.closeErr = errors.Join(errs...)
+	})
+	return b.closeErr
+}
+
+// failed обрабатывает пакет, который не удалось отправить.
+func (b *batcher) failed(batch []remoteEntry, err error) {
+	if b.fallback != nil {
+		fallbackErr := b.fallback(batch)
+		if fallbackErr == nil {
+			b.onError(fmt.Errorf("logger: %s: записей в запасном выводе: %d: %w", b.name, len(batch), err))
+			return
+		}
+		err = fmt.Errorf("%w; запасной вывод: %v", err, fallbackErr)
+	}
+	b.dropped.Add(int64(len(batch)))
+	b.onError(fmt.Errorf("logger: %s: отброшено записей: %d: %w", b.name, len(batch), err))
+}
+
+// setDown сообщает о недоступности приемника один раз до восстановления.
+func (b *batcher) setDown(down bool, err error) {
+	b.mu.Lock()
+	report := down && !b.down
+	b.down = down
+	b.mu.Unlock()
+	if report {
+		b.onError(fmt.Errorf("logger: %s недоступен, отправка повторяется: %w", b.name, err))
+	}
+}
+
+// stats возвращает состояние очереди.
+func (b *batcher) stats() QueueStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := QueueStats{Name: b.name, Entries: b.entries, Bytes: b.bytes, Dropped: b.dropped.Load()}
+	if b.spool != nil {
+		stats.SpoolBytes = b.spool.diskBytes
+	}
+	return stats
+}
+
+// setFallbackFile направляет пакеты, которые не удалось отправить, в запасной
+// файл. Записи пишутся в исходном кодировании, по одной на строку; ротация - из
+// LoggerConf. Файл закрывается вместе с batcher.
+func (b *batcher) setFallbackFile(params *Params, name string) error {
+	w, err := newFileWriter(params, OutputConf{Type: OutputFile, FileName: name})
+	if err != nil {
+		return err
+	}
+	b.closers = append(b.closers, w.Close)
+	b.fallback = func(batch []remoteEntry) error {
+		var data []byte
+		for _, e := range batch {
+			data = append(data, e.data...)
+			data = append(data, '\n')
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return w.Sync()
+	}
+	return nil
+}
+
+// remoteCore кодирует записи кодировщиком вывода и передает их batcher.
+type remoteCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	key func(ent zapcore.Entry, fields []zapcore.Field) string
+	b   *batcher
+}
+
+func (c *remoteCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *remoteCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *remoteCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	data := bytes.Clone(bytes.TrimRight(buf.Bytes(), "\n"))
+	buf.Free()
+	c.b.add(remoteEntry{key: c.key(ent, fields), time: ent.Time, data: data})
+	if ent.Level > zapcore.ErrorLevel {
+		// Как zapcore.ioCore: перед паникой или завершением процесса дожидаемся отправки.
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *remoteCore) Sync() error {
+	return c.b.flush()
+}
+
+// close останавливает фоновую горутину batcher и закрывает соединение
+// с приемником. Close вызывает его после Sync, который уже дождался отправки
+// накопленных записей: повторное ожидание недоступного приемника удвоило бы
+// время закрытия.
+func (c *remoteCore) close() {
+	if err := c.b.close(); err != nil {
+		c.b.onError(fmt.Errorf("logger: %s: закрытие: %w", c.b.name, err))
+	}
+}
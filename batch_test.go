@@ -0,0 +1,101 @@
+package logit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCloseStopsRemoteOutputs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4096)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				close(closed) // логгер закрыл соединение
+				return
+			}
+		}
+	}()
+
+	before := runtime.NumGoroutine()
+	l := MustNewLogger(newOutputTestParams(t, OutputConf{
+		Type:   OutputSyslog,
+		Syslog: &SyslogConf{Network: "tcp", Address: ln.Addr().String(), Batch: testBatchConf()},
+	}))
+	l.Info(context.Background(), "before close")
+	if err := Close(l); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("соединение с syslog не закрыто")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("горутин после Close: %d, до создания логгера: %d", n, before)
+	}
+}
+
+func TestBatcherCloseInterruptsRetries(t *testing.T) {
+	var sends atomic.Int32
+	conf := testBatchConf()
+	conf.MinBackoff, conf.MaxBackoff = time.Hour, time.Hour
+	b := newBatcher("test", conf, func(context.Context, []remoteEntry) error {
+		sends.Add(1)
+		return errors.New("unavailable")
+	}, func(error) {})
+	params := newOutputTestParams(t, OutputConf{})
+	if err := b.setFallbackFile(params, "fallback.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.add(remoteEntry{data: []byte(`{"msg":"pending"}`)})
+	b.mu.Lock()
+	b.flushNow = true
+	b.mu.Unlock()
+	b.signal()
+	for sends.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() { done <- b.close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("close ждет паузы между повторами")
+	}
+	data, err := os.ReadFile(filepath.Join(params.LoggerConf.Dir, "fallback.log"))
+	if err != nil || !strings.Contains(string(data), "pending") {
+		t.Errorf("запасной файл: %q, %v; ожидалась недоставленная запись", data, err)
+	}
+	if err := b.close(); err != nil {
+		t.Errorf("повторный close: %v", err)
+	}
+}
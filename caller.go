@@ -0,0 +1,60 @@
+package logit
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"runtime"
+)
+
+// WithCallerSkip возвращает логгер, который при определении места вызова и
+// стектрейса пропускает еще skip кадров. Нужен вспомогательным функциям приложения,
+// которые сами вызывают логгер, чтобы в записи было место вызова самой функции:
+//
+//	func logFailure(ctx context.Context, l logit.Logger, err error) {
+//		logit.WithCallerSkip(l, 1).Error(ctx, err)
+//	}
+//
+// Логгеры, созданные не через MustNewLogger/NewNopLogger, возвращаются без изменений.
+func WithCallerSkip(l Logger, skip int) Logger {
+	li, ok := l.(*logIt)
+	if !ok || skip == 0 {
+		return l
+	}
+	clone := *li
+	clone.logger = li.logger.WithOptions(zap.AddCallerSkip(skip))
+	return &clone
+}
+
+// With возвращает дочерний логгер, добавляющий fields в каждую запись.
+// Дочерний логгер определяет место вызова так же, как родительский.
+func With(l Logger, fields ...zap.Field) Logger {
+	li, ok := l.(*logIt)
+	if !ok || len(fields) == 0 {
+		return l
+	}
+	clone := *li
+	clone.logger = li.logger.With(fields...)
+	return &clone
+}
+
+// zapFields кодирует набор полей как вложенный объект.
+type zapFields []zap.Field
+
+func (fs zapFields) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range fs {
+		f.AddTo(enc)
+	}
+	return nil
+}
+
+// frameCaller возвращает место вызова для адреса pc.
+func frameCaller(pc uintptr) zapcore.EntryCaller {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return zapcore.EntryCaller{
+		Defined:  true,
+		PC:       frame.PC,
+		File:     frame.File,
+		Line:     frame.Line,
+		Function: frame.Function,
+	}
+}
@@ -0,0 +1,123 @@
+package logit
+
+import (
+	"context"
+	"errors"
+	"github.com/x3a-tech/configo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// newObservedLogger создает логгер через MustNewLogger и заменяет его ядро
+// наблюдателем. Опции логгера (пропуск кадров, место вызова) сохраняются,
+// а Fatal вместо завершения процесса вызывает панику.
+func newObservedLogger(t *testing.T) (Logger, *observer.ObservedLogs) {
+	t.Helper()
+	env := configo.Env("prod")
+	l := MustNewLogger(&Params{
+		AppConf:      &configo.App{Name: "app", Version: "1"},
+		LoggerConf:   &configo.Logger{Dir: t.TempDir()},
+		Env:          &env,
+		EnableCaller: true,
+		Outputs:      []OutputConf{{Type: OutputFile}},
+	})
+	core, logs := observer.New(zapcore.DebugLevel)
+	li := l.(*logIt)
+	li.logger = li.logger.WithOptions(
+		zap.WrapCore(func(zapcore.Core) zapcore.Core { return core }),
+		zap.WithFatalHook(zapcore.WriteThenPanic),
+	)
+	return li, logs
+}
+
+// funcLine возвращает строку, с которой начинается функция fn. Случаи ниже
+// записаны в одну строку, поэтому это и строка вызова логгера.
+func funcLine(fn func()) int {
+	_, line := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).FileLine(reflect.ValueOf(fn).Pointer())
+	return line
+}
+
+// logFailure - вспомогательная функция приложения: место вызова - код, вызвавший ее.
+func logFailure(ctx context.Context, l Logger, err error) {
+	WithCallerSkip(l, 1).Error(ctx, err)
+}
+
+func TestCallerPointsToApplicationCode(t *testing.T) {
+	l, logs := newObservedLogger(t)
+	ctx := context.Background()
+	err := errors.New("boom")
+	child := With(l, zap.String("component", "test"))
+	slogger := slog.New(NewSlogHandler(l))
+	writer := NewLineWriter(l, zapcore.InfoLevel, "test")
+
+	cases := map[string]func(){
+		"Debug":          func() { l.Debug(ctx, "debug") },
+		"Info":           func() { l.Info(ctx, "info") },
+		"Infof":          func() { l.Infof(ctx, "info %d", 1) },
+		"Warn":           func() { l.Warn(ctx, "warn") },
+		"Warnf":          func() { l.Warnf(ctx, "warn %d", 1) },
+		"Error":          func() { l.Error(ctx, err) },
+		"Errorf":         func() { l.Errorf(ctx, "error %d", 1) },
+		"Fatal":          func() { l.Fatal(ctx, err) },
+		"Fatalf":         func() { l.Fatalf(ctx, "fatal %d", 1) },
+		"With":           func() { child.Info(ctx, "child") },
+		"WithNested":     func() { With(child, zap.Int("n", 1)).Warn(ctx, "nested") },
+		"WithCallerSkip": func() { logFailure(ctx, l, err) },
+		"SkipAfterWith":  func() { logFailure(ctx, child, err) },
+		"slog.Info":      func() { slogger.Info("slog") },
+		"slog.Context":   func() { slogger.ErrorContext(ctx, "slog") },
+		"slog.With":      func() { slogger.With("k", "v").WithGroup("g").Warn("slog") },
+		"LineWriter":     func() { _, _ = writer.Write([]byte("line\n")) },
+	}
+	for name, fn := range cases {
+		t.Run(name, func(t *testing.T) {
+			logs.TakeAll()
+			func() {
+				defer func() { _ = recover() }() // Fatal паникует после записи
+				fn()
+			}()
+			assertCaller(t, logs, funcLine(fn))
+		})
+	}
+}
+
+func TestCallerThroughStdLog(t *testing.T) {
+	l, logs := newObservedLogger(t)
+	restore := RedirectStdLog(l, zapcore.InfoLevel)
+	defer restore()
+
+	cases := map[string]func(){
+		"Print":   func() { log.Print("std") },
+		"Printf":  func() { log.Printf("std %d", 1) },
+		"Println": func() { log.Println("WARN: std") },
+	}
+	for name, fn := range cases {
+		t.Run(name, func(t *testing.T) {
+			logs.TakeAll()
+			fn()
+			assertCaller(t, logs, funcLine(fn))
+		})
+	}
+}
+
+func assertCaller(t *testing.T, logs *observer.ObservedLogs, line int) {
+	t.Helper()
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatalf("записей: %d, ожидалась одна", len(entries))
+	}
+	caller := entries[0].Caller
+	if !caller.Defined {
+		t.Fatal("место вызова не определено")
+	}
+	if filepath.Base(caller.File) != "caller_test.go" || caller.Line != line {
+		t.Errorf("место вызова %s:%d, ожидалось caller_test.go:%d", caller.File, caller.Line, line)
+	}
+}
@@ -0,0 +1,284 @@
+package logit
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Алгоритмы сжатия ротированных файлов.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// backupTimeFormat повторяет формат метки времени, который lumberjack
+// вставляет в имя ротированного файла: <prefix>-<timestamp><ext>.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// CompressionConf описывает сжатие ротированных лог-файлов.
+type CompressionConf struct {
+	Algorithm string `yaml:"algorithm" json:"algorithm"` // gzip или zstd
+	Level     int    `yaml:"level" json:"level"`         // 0 - уровень по умолчанию для алгоритма
+	QueueSize int    `yaml:"queueSize" json:"queueSize"` // размер очереди фонового воркера, 0 - значение по умолчанию
+}
+
+// Compressor сжимает ротированные файлы и умеет читать их обратно.
+// Ext возвращает суффикс, добавляемый к имени сжатого файла (например, ".gz").
+type Compressor interface {
+	Ext() string
+	Compress(dst io.Writer, src io.Reader) error
+	Decompress(src io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompressor сжимает файлы в формате gzip.
+// Level соответствует уровням compress/gzip; 0 означает gzip.DefaultCompression.
+type GzipCompressor struct {
+	Level int
+}
+
+// Ext реализует Compressor.
+func (c GzipCompressor) Ext() string { return ".gz" }
+
+// Compress реализует Compressor.
+func (c GzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	zw, err := gzip.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Decompress реализует Compressor.
+func (c GzipCompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(src)
+}
+
+// ZstdCompressor сжимает файлы в формате zstd.
+// Level задается в терминах zstd (1-22); 0 означает уровень по умолчанию.
+type ZstdCompressor struct {
+	Level int
+}
+
+// Ext реализует Compressor.
+func (c ZstdCompressor) Ext() string { return ".zst" }
+
+// Compress реализует Compressor.
+func (c ZstdCompressor) Compress(dst io.Writer, src io.Reader) error {
+	var opts []zstd.EOption
+	if c.Level > 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	}
+	zw, err := zstd.NewWriter(dst, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Decompress реализует Compressor.
+func (c ZstdCompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// NewCompressor возвращает Compressor по имени алгоритма из конфигурации.
+func NewCompressor(algorithm string, level int) (Compressor, error) {
+	switch strings.ToLower(algorithm) {
+	case CompressionGzip, "gz":
+		return GzipCompressor{Level: level}, nil
+	case CompressionZstd, "zst":
+		return ZstdCompressor{Level: level}, nil
+	default:
+		return nil, fmt.Errorf("logger: неизвестный алгоритм сжатия %q", algorithm)
+	}
+}
+
+// compressors - известные форматы сжатия, по которым распознаются ротированные файлы.
+var compressors = []Compressor{GzipCompressor{}, ZstdCompressor{}}
+
+// compressorByName возвращает Compressor, которым был сжат файл, по его расширению.
+func compressorByName(name string) (Compressor, bool) {
+	for _, c := range compressors {
+		if strings.HasSuffix(name, c.Ext()) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// OpenLogFile открывает лог-файл (текущий или ротированный) для чтения,
+// прозрачно распаковывая его, если имя оканчивается на .gz или .zst.
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := compressorByName(path)
+	if !ok {
+		return f, nil
+	}
+	r, err := c.Decompress(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("logger: не удалось распаковать %s: %w", path, err)
+	}
+	return &stackedReadCloser{Reader: r, closers: []io.Closer{r, f}}, nil
+}
+
+// stackedReadCloser закрывает все слои чтения в заданном порядке.
+type stackedReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (s *stackedReadCloser) Close() error {
+	var firstErr error
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// compressFile сжимает src в src+c.Ext() и удаляет исходный файл.
+// Результат сначала пишется во временный файл, чтобы читатели и ретеншн
+// никогда не видели частично сжатый бэкап.
+func compressFile(c Compressor, src string) (string, error) {
+	dst := src + c.Ext()
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return "", err
+	}
+	if err := c.Compress(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return dst, os.Remove(src)
+}
+
+// backupFile - ротированный файл, созданный lumberjack.
+type backupFile struct {
+	path      string
+	timestamp time.Time
+}
+
+// listBackups возвращает бэкапы для основного файла filename, отсортированные
+// от старых к новым. suffix задает дополнительное расширение бэкапа ("" - несжатые,
+// ".zst" - сжатые zstd и т.д.).
+func listBackups(filename, suffix string, local bool) ([]backupFile, error) {
+	dir := filepath.Dir(filename)
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)] + "-"
+	ext += suffix
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := time.UTC
+	if local {
+		loc = time.Local
+	}
+
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts := name[len(prefix) : len(name)-len(ext)]
+		t, err := time.ParseInLocation(backupTimeFormat, ts, loc)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), timestamp: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].timestamp.Before(backups[j].timestamp) })
+	return backups, nil
+}
+
+// pruneBackups применяет ограничения MaxBackups/MaxAge к сжатым бэкапам
+// с расширением suffix. lumberjack распознает только .gz, поэтому для
+// остальных форматов ретеншн выполняется здесь.
+func pruneBackups(filename, suffix string, local bool, maxBackups, maxAge int) error {
+	if maxBackups <= 0 && maxAge <= 0 {
+		return nil
+	}
+	backups, err := listBackups(filename, suffix, local)
+	if err != nil {
+		return err
+	}
+
+	var remove []backupFile
+	if maxBackups > 0 && len(backups) > maxBackups {
+		remove = append(remove, backups[:len(backups)-maxBackups]...)
+		backups = backups[len(backups)-maxBackups:]
+	}
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-time.Duration(maxAge) * 24 * time.Hour)
+		for _, b := range backups {
+			if b.timestamp.Before(cutoff) {
+				remove = append(remove, b)
+			}
+		}
+	}
+
+	var firstErr error
+	for _, b := range remove {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,197 @@
+package logit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultIndexDateFormat - суффикс индекса по умолчанию: индекс на каждый день.
+const defaultIndexDateFormat = "2006.01.02"
+
+// ElasticsearchConf задает индексацию записей в Elasticsearch или OpenSearch
+// через _bulk API (тип вывода elasticsearch).
+type ElasticsearchConf struct {
+	// URLs - адреса узлов кластера; при ошибке запрос повторяется на следующем узле.
+	URLs []string `yaml:"urls" json:"urls"`
+	// Index - префикс имени индекса; по умолчанию AppConf.Name в нижнем регистре.
+	// Полное имя - <Index>-<дата записи в UTC по IndexDateFormat>.
+	Index           string            `yaml:"index" json:"index"`
+	IndexDateFormat string            `yaml:"indexDateFormat" json:"indexDateFormat"` // по умолчанию 2006.01.02
+	Username        string            `yaml:"username" json:"username"`               // basic auth
+	Password        string            `yaml:"password" json:"password"`
+	APIKey          string            `yaml:"apiKey" json:"apiKey"` // заголовок Authorization: ApiKey
+	Headers         map[string]string `yaml:"headers" json:"headers"`
+	TLS             *TLSConf          `yaml:"tls" json:"tls"`
+	Batch           *BatchConf        `yaml:"batch" json:"batch"`
+	// FallbackFile - файл (относительно LoggerConf.Dir), в который пишутся документы,
+	// не принятые кластером или не отправленные из-за его недоступности.
+	FallbackFile string `yaml:"fallbackFile" json:"fallbackFile"`
+}
+
+// newElasticsearchCore создает ядро индексации записей пакетами через _bulk API.
+// Документы кодируются кодировщиком вывода (по умолчанию json).
+func newElasticsearchCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Elasticsearch
+	if conf == nil || len(conf.URLs) == 0 {
+		return nil, fmt.Errorf("logger: для вывода %q нужны адреса узлов (urls)", OutputElasticsearch)
+	}
+	index := conf.Index
+	if index == "" {
+		index = params.AppConf.Name
+	}
+	index = indexName(index)
+	if index == "" {
+		return nil, errors.New("logger: пустое имя индекса Elasticsearch")
+	}
+	dateFormat := conf.IndexDateFormat
+	if dateFormat == "" {
+		dateFormat = defaultIndexDateFormat
+	}
+
+	client, err := httpClient(conf.TLS, 0)
+	if err != nil {
+		return nil, err
+	}
+	bulk := &esBulk{client: client, header: http.Header{}}
+	for _, u := range conf.URLs {
+		bulk.urls = append(bulk.urls, strings.TrimRight(u, "/")+"/_bulk")
+	}
+	for k, v := range conf.Headers {
+		bulk.header.Set(k, v)
+	}
+	switch {
+	case conf.APIKey != "":
+		bulk.header.Set("Authorization", "ApiKey "+conf.APIKey)
+	case conf.Username != "":
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(conf.Username, conf.Password)
+		bulk.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+	bulk.header.Set("Content-Type", "application/x-ndjson")
+
+	encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	b := newBatcher("Elasticsearch "+conf.URLs[0], conf.Batch, bulk.send, params.errorHandler())
+	b.closers = append(b.closers, closeIdle(client))
+	if conf.FallbackFile != "" {
+		if err := b.setFallbackFile(params, conf.FallbackFile); err != nil {
+			_ = b.close()
+			return nil, err
+		}
+	}
+	bulk.rejected = b.failed
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          encoder,
+		key: func(ent zapcore.Entry, _ []zapcore.Field) string {
+			return index + "-" + ent.Time.UTC().Format(dateFormat)
+		},
+		b: b,
+	}, nil
+}
+
+// indexName приводит имя к допустимому имени индекса: нижний регистр,
+// запрещенные символы заменяются на '-', без '-', '_', '+' и '.' в начале.
+func indexName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/*?"<>| ,#:`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	return strings.TrimLeft(name, "-_+.")
+}
+
+// esBulk отправляет пакеты в _bulk API.
+type esBulk struct {
+	urls     []string
+	node     atomic.Int32 // текущий узел
+	client   *http.Client
+	header   http.Header
+	rejected func(batch []remoteEntry, err error) // документы, отклоненные кластером
+}
+
+// esBulkResponse - часть ответа _bulk, нужная для разбора ошибок по документам.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// send индексирует пакет. Документы, отклоненные с кодом 429 или 5xx, повторяются;
+// остальные отклоненные документы передаются rejected.
+func (e *esBulk) send(ctx context.Context, batch []remoteEntry) error {
+	var body []byte
+	for _, entry := range batch {
+		body = append(body, `{"create":{"_index":`...)
+		body = appendJSONString(body, entry.key)
+		body = append(body, "}}\n"...)
+		body = append(body, entry.data...)
+		body = append(body, '\n')
+	}
+
+	node := int(e.node.Load()) % len(e.urls)
+	resp, err := postHTTP(ctx, e.client, e.urls[node], e.header, body)
+	if err != nil {
+		var permanent *permanentError
+		if !errors.As(err, &permanent) {
+			e.node.CompareAndSwap(int32(node), int32((node+1)%len(e.urls)))
+		}
+		return err
+	}
+
+	var result esBulkResponse
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return &permanentError{fmt.Errorf("разбор ответа _bulk: %w", err)}
+	}
+	if !result.Errors {
+		return nil
+	}
+	if len(result.Items) != len(batch) {
+		return &permanentError{fmt.Errorf("ответ _bulk содержит %d результатов вместо %d", len(result.Items), len(batch))}
+	}
+
+	var retry, rejected []remoteEntry
+	var retryErr, rejectErr error
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300:
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = append(retry, batch[i])
+				if retryErr == nil {
+					retryErr = fmt.Errorf("документ отклонен: HTTP %d: %s", r.Status, r.Error)
+				}
+			default:
+				rejected = append(rejected, batch[i])
+				if rejectErr == nil {
+					rejectErr = fmt.Errorf("документ отклонен: HTTP %d: %s", r.Status, r.Error)
+				}
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		e.rejected(rejected, rejectErr)
+	}
+	if len(retry) > 0 {
+		return &partialError{entries: retry, err: retryErr}
+	}
+	return nil
+}
+
+// appendJSONString добавляет s как строку JSON.
+func appendJSONString(dst []byte, s string) []byte {
+	data, _ := json.Marshal(s)
+	return append(dst, data...)
+}
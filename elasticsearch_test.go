@@ -0,0 +1,249 @@
+package logit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkDoc - документ из запроса _bulk.
+type bulkDoc struct {
+	index string
+	msg   string
+}
+
+// bulkServer разбирает запросы _bulk и отвечает функцией respond.
+type bulkServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests [][]bulkDoc
+	respond  func(n int, docs []bulkDoc) (status int, body string) // n - номер запроса с 0
+}
+
+func newBulkServer(t *testing.T, respond func(n int, docs []bulkDoc) (int, string)) *bulkServer {
+	t.Helper()
+	s := &bulkServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("запрос %s с Content-Type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var docs []bulkDoc
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			var action struct {
+				Create struct {
+					Index string `json:"_index"`
+				} `json:"create"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &action); err != nil || action.Create.Index == "" {
+				t.Errorf("строка действия %q: %v", sc.Text(), err)
+			}
+			if !sc.Scan() {
+				t.Error("нет документа после строки действия")
+				break
+			}
+			var doc map[string]any
+			if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+				t.Errorf("документ %q: %v", sc.Text(), err)
+			}
+			msg, _ := doc["msg"].(string)
+			docs = append(docs, bulkDoc{index: action.Create.Index, msg: msg})
+		}
+		s.mu.Lock()
+		n := len(s.requests)
+		s.requests = append(s.requests, docs)
+		s.mu.Unlock()
+		status, body := s.respond(n, docs)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *bulkServer) recorded() [][]bulkDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]bulkDoc(nil), s.requests...)
+}
+
+// bulkResponse формирует ответ _bulk со статусами документов.
+func bulkResponse(statuses ...int) string {
+	items := make([]string, len(statuses))
+	failed := false
+	for i, status := range statuses {
+		if status >= 300 {
+			failed = true
+			items[i] = fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"test_error","reason":"status %d"}}}`, status, status)
+		} else {
+			items[i] = fmt.Sprintf(`{"create":{"status":%d}}`, status)
+		}
+	}
+	return fmt.Sprintf(`{"errors":%t,"items":[%s]}`, failed, strings.Join(items, ","))
+}
+
+// bulkCreated формирует ответ _bulk, в котором все n документов созданы.
+func bulkCreated(n int) string {
+	statuses := make([]int, n)
+	for i := range statuses {
+		statuses[i] = http.StatusCreated
+	}
+	return bulkResponse(statuses...)
+}
+
+func docMessages(docs []bulkDoc) []string {
+	msgs := make([]string, len(docs))
+	for i, d := range docs {
+		msgs[i] = d.msg
+	}
+	return msgs
+}
+
+// fallbackMessages читает сообщения из запасного файла.
+func fallbackMessages(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var doc map[string]any
+		if err := json.Unmarshal(line, &doc); err != nil {
+			t.Fatalf("строка запасного файла %q: %v", line, err)
+		}
+		msgs = append(msgs, doc["msg"].(string))
+	}
+	return msgs
+}
+
+func newElasticsearchTestLogger(t *testing.T, urls ...string) (Logger, string) {
+	t.Helper()
+	params := newOutputTestParams(t, OutputConf{Type: OutputElasticsearch, Elasticsearch: &ElasticsearchConf{
+		URLs:         urls,
+		FallbackFile: "es-fallback.log",
+		Batch:        testBatchConf(),
+	}})
+	return newParamsTestLogger(t, params), filepath.Join(params.LoggerConf.Dir, "es-fallback.log")
+}
+
+func logMessages(l Logger, msgs ...string) {
+	for _, msg := range msgs {
+		l.Info(context.Background(), msg)
+	}
+}
+
+func TestElasticsearchRetriesOnlyRetryableItems(t *testing.T) {
+	srv := newBulkServer(t, func(n int, docs []bulkDoc) (int, string) {
+		switch n {
+		case 0:
+			return http.StatusOK, bulkResponse(201, 429, 400, 503, 201)
+		default:
+			return http.StatusOK, bulkCreated(len(docs))
+		}
+	})
+	l, fallback := newElasticsearchTestLogger(t, srv.URL)
+	logMessages(l, "ok-1", "throttled", "bad", "unavailable", "ok-2")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 2 {
+		t.Fatalf("запросов: %d, ожидалось 2", len(reqs))
+	}
+	wantIndex := "app-" + time.Now().UTC().Format(defaultIndexDateFormat)
+	for _, d := range reqs[0] {
+		if d.index != wantIndex {
+			t.Errorf("индекс %q, ожидался %q", d.index, wantIndex)
+		}
+	}
+	if got := strings.Join(docMessages(reqs[1]), ","); got != "throttled,unavailable" {
+		t.Errorf("повторно отправлены %s, ожидались документы с 429 и 503", got)
+	}
+	if got := strings.Join(fallbackMessages(t, fallback), ","); got != "bad" {
+		t.Errorf("в запасном файле %q, ожидался документ с 400", got)
+	}
+}
+
+func TestElasticsearchFailsOverToNextNode(t *testing.T) {
+	down := newBulkServer(t, func(int, []bulkDoc) (int, string) {
+		return http.StatusServiceUnavailable, `{"error":"unavailable"}`
+	})
+	up := newBulkServer(t, func(_ int, docs []bulkDoc) (int, string) {
+		return http.StatusOK, bulkCreated(len(docs))
+	})
+	l, fallback := newElasticsearchTestLogger(t, down.URL, up.URL)
+
+	logMessages(l, "first")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	// Следующий пакет сразу уходит на рабочий узел.
+	logMessages(l, "second")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := len(down.recorded()); n != 1 {
+		t.Errorf("запросов к недоступному узлу: %d, ожидался один", n)
+	}
+	reqs := up.recorded()
+	if len(reqs) != 2 || reqs[0][0].msg != "first" || reqs[1][0].msg != "second" {
+		t.Errorf("запросы к рабочему узлу: %v", reqs)
+	}
+	if msgs := fallbackMessages(t, fallback); len(msgs) != 0 {
+		t.Errorf("запасной файл: %v", msgs)
+	}
+}
+
+func TestElasticsearchItemsMismatchGoesToFallback(t *testing.T) {
+	srv := newBulkServer(t, func(int, []bulkDoc) (int, string) {
+		return http.StatusOK, bulkResponse(500) // один результат на два документа
+	})
+	l, fallback := newElasticsearchTestLogger(t, srv.URL)
+	logMessages(l, "a", "b")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := len(srv.recorded()); n != 1 {
+		t.Errorf("запросов: %d, ответ с неверным числом результатов не должен повторяться", n)
+	}
+	if got := strings.Join(fallbackMessages(t, fallback), ","); got != "a,b" {
+		t.Errorf("в запасном файле %q, ожидался весь пакет", got)
+	}
+}
+
+func TestElasticsearchRequestRejectedGoesToFallback(t *testing.T) {
+	srv := newBulkServer(t, func(int, []bulkDoc) (int, string) {
+		return http.StatusBadRequest, `{"error":"bad request"}`
+	})
+	l, fallback := newElasticsearchTestLogger(t, srv.URL)
+	logMessages(l, "a", "b")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := len(srv.recorded()); n != 1 {
+		t.Errorf("запросов: %d, ответ 400 не должен повторяться", n)
+	}
+	if got := strings.Join(fallbackMessages(t, fallback), ","); got != "a,b" {
+		t.Errorf("в запасном файле %q", got)
+	}
+}
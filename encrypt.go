@@ -0,0 +1,329 @@
+package logit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Формат зашифрованного файла - последовательность записей
+// [тип: 1 байт][длина данных: 4 байта big-endian][данные]:
+//
+//	'H' - заголовок: encMagic, длина идентификатора ключа (1 байт), идентификатор,
+//	      случайная соль (encSaltLen байт);
+//	'F' - кадр: nonce AES-GCM (12 байт) и шифртекст одной записи Write.
+//
+// Заголовок пишется в начало каждого нового файла и после каждого открытия
+// существующего, поэтому файл можно дописывать после перезапуска и смены ключа.
+// Кадры шифруются не самим ключом, а ключом, выведенным из него и соли заголовка
+// через HKDF-SHA256. Идентификатор ключа передается в GCM как дополнительные данные.
+const (
+	encRecordHeader = 'H'
+	encRecordFrame  = 'F'
+	encMagic        = "LOGITENC2"
+	encPrefixLen    = 5
+	encSaltLen      = 32
+	encKeyInfo      = "logit-go file frames"
+	// maxEncRecord ограничивает длину записи при чтении, чтобы поврежденный файл
+	// не приводил к выделению гигантского буфера.
+	maxEncRecord = 64 << 20
+)
+
+// encFramesPerKey - сколько кадров шифруется одним выведенным ключом. Случайные
+// 96-битные nonce GCM допустимы примерно до 2^32 сообщений на ключ (NIST SP 800-38D),
+// поэтому раньше этого ключ выводится заново с новой солью и пишется новый заголовок.
+var encFramesPerKey uint64 = 1 << 31
+
+// ErrNotEncrypted возвращается при чтении файла, который не начинается с заголовка шифрования.
+var ErrNotEncrypted = errors.New("logger: файл не зашифрован")
+
+// KeyProvider предоставляет ключи AES (16, 24 или 32 байта) для шифрования файлов.
+type KeyProvider interface {
+	// CurrentKey возвращает ключ для новых файлов. Запрашивается при открытии
+	// каждого файла, поэтому смена ключа вступает в силу со следующей ротацией.
+	CurrentKey() (id string, key []byte, err error)
+	// Key возвращает ключ по идентификатору из заголовка файла.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys - KeyProvider с фиксированным набором ключей. Старые ключи
+// оставляют в Keys, чтобы читать файлы, зашифрованные до смены ключа.
+type StaticKeys struct {
+	CurrentID string
+	Keys      map[string][]byte
+}
+
+// NewStaticKeys создает StaticKeys с единственным ключом key под идентификатором id.
+func NewStaticKeys(id string, key []byte) *StaticKeys {
+	return &StaticKeys{CurrentID: id, Keys: map[string][]byte{id: key}}
+}
+
+func (s *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.CurrentID)
+	return s.CurrentID, key, err
+}
+
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("logger: неизвестный ключ шифрования %q", id)
+	}
+	return key, nil
+}
+
+// EncryptionConf - статический ключ шифрования файлов из конфигурации.
+type EncryptionConf struct {
+	KeyID string `yaml:"keyId" json:"keyId"`
+	// Key - ключ AES в base64 (16, 24 или 32 байта после декодирования).
+	Key string `yaml:"key" json:"key"`
+}
+
+// keys возвращает KeyProvider для ключа из конфигурации.
+func (c *EncryptionConf) keys() (KeyProvider, error) {
+	key, err := base64.StdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("logger: ключ шифрования должен быть в base64: %w", err)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("logger: некорректный ключ шифрования: %w", err)
+	}
+	if len(c.KeyID) > 255 {
+		return nil, errors.New("logger: идентификатор ключа шифрования длиннее 255 байт")
+	}
+	return NewStaticKeys(c.KeyID, key), nil
+}
+
+// keyProvider возвращает ключи шифрования файлового вывода out или nil,
+// если шифрование не включено.
+func (p *Params) keyProvider(out OutputConf) (KeyProvider, error) {
+	conf := out.Encryption
+	if conf == nil {
+		conf = p.Encryption
+	}
+	if conf != nil {
+		return conf.keys()
+	}
+	return p.KeyProvider, nil
+}
+
+// newGCM создает AES-GCM для ключа кадров, выведенного из key и соли заголовка.
+func newGCM(key, salt []byte) (cipher.AEAD, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("logger: некорректный ключ шифрования: %w", err)
+	}
+	frameKey, err := hkdf.Key(sha256.New, key, salt, encKeyInfo, len(key))
+	if err != nil {
+		return nil, fmt.Errorf("logger: вывод ключа шифрования: %w", err)
+	}
+	block, err := aes.NewCipher(frameKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileEncryptor шифрует записи текущего файла ключом, полученным при его открытии.
+type fileEncryptor struct {
+	keys   KeyProvider
+	keyID  string
+	key    []byte
+	aead   cipher.AEAD
+	header []byte
+	frames uint64 // кадров зашифровано текущим выведенным ключом
+}
+
+// refresh запрашивает текущий ключ; вызывается перед заголовком нового файла.
+func (e *fileEncryptor) refresh() error {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return fmt.Errorf("logger: получение ключа шифрования: %w", err)
+	}
+	if len(id) > 255 {
+		return errors.New("logger: идентификатор ключа шифрования длиннее 255 байт")
+	}
+	if e.aead != nil && id == e.keyID {
+		return nil
+	}
+	return e.rekey(id, key)
+}
+
+// rekey выводит новый ключ кадров со случайной солью и готовит его заголовок.
+func (e *fileEncryptor) rekey(id string, key []byte) error {
+	salt := make([]byte, encSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("logger: генерация соли ключа шифрования: %w", err)
+	}
+	aead, err := newGCM(key, salt)
+	if err != nil {
+		return err
+	}
+	e.keyID, e.key, e.aead, e.frames = id, key, aead, 0
+
+	payload := make([]byte, 0, len(encMagic)+1+len(id)+encSaltLen)
+	payload = append(payload, encMagic...)
+	payload = append(payload, byte(len(id)))
+	payload = append(payload, id...)
+	payload = append(payload, salt...)
+	e.header = appendEncRecord(nil, encRecordHeader, payload)
+	return nil
+}
+
+// seal шифрует p в кадр; если withHeader, кадру предшествует заголовок.
+// После encFramesPerKey кадров ключ кадров выводится заново, и кадру
+// предшествует новый заголовок.
+func (e *fileEncryptor) seal(p []byte, withHeader bool) ([]byte, error) {
+	if e.frames >= encFramesPerKey {
+		if err := e.rekey(e.keyID, e.key); err != nil {
+			return nil, err
+		}
+		withHeader = true
+	}
+	e.frames++
+	nonceSize := e.aead.NonceSize()
+	size := encPrefixLen + nonceSize + len(p) + e.aead.Overhead()
+	var out []byte
+	if withHeader {
+		out = make([]byte, 0, len(e.header)+size)
+		out = append(out, e.header...)
+	} else {
+		out = make([]byte, 0, size)
+	}
+	out = append(out, encRecordFrame, 0, 0, 0, 0)
+	lenAt := len(out) - 4
+	nonce := out[len(out) : len(out)+nonceSize]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("logger: генерация nonce: %w", err)
+	}
+	out = out[:len(out)+nonceSize]
+	out = e.aead.Seal(out, nonce, p, []byte(e.keyID))
+	binary.BigEndian.PutUint32(out[lenAt:], uint32(len(out)-lenAt-4))
+	return out, nil
+}
+
+func appendEncRecord(dst []byte, typ byte, payload []byte) []byte {
+	dst = append(dst, typ, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(dst[len(dst)-4:], uint32(len(payload)))
+	return append(dst, payload...)
+}
+
+// WithEncryption включает шифрование записей AES-GCM ключами keys.
+func WithEncryption(keys KeyProvider) RotatingOption {
+	return func(w *TimeRotatingWriter) {
+		w.encryptor = &fileEncryptor{keys: keys}
+	}
+}
+
+// NewDecryptingReader возвращает поток расшифрованных записей файла, записанного
+// с шифрованием. Ключи запрашиваются у keys по идентификаторам из заголовков.
+func NewDecryptingReader(r io.Reader, keys KeyProvider) io.Reader {
+	return &decryptingReader{r: bufio.NewReader(r), keys: keys}
+}
+
+type decryptingReader struct {
+	r      *bufio.Reader
+	keys   KeyProvider
+	keyID  string
+	header []byte // данные последнего заголовка
+	aead   cipher.AEAD
+	buf    []byte // расшифрованный, еще не прочитанный текст
+	rec    []byte
+	err    error
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next читает следующую запись файла.
+func (d *decryptingReader) next() error {
+	var prefix [encPrefixLen]byte
+	if _, err := io.ReadFull(d.r, prefix[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			if d.aead == nil {
+				return ErrNotEncrypted
+			}
+			return io.EOF
+		}
+		return fmt.Errorf("logger: зашифрованный файл обрезан: %w", io.ErrUnexpectedEOF)
+	}
+	typ, size := prefix[0], binary.BigEndian.Uint32(prefix[1:])
+	if d.aead == nil && typ != encRecordHeader {
+		return ErrNotEncrypted
+	}
+	if size > maxEncRecord {
+		return fmt.Errorf("logger: поврежденный зашифрованный файл: запись %d байт", size)
+	}
+	if cap(d.rec) < int(size) {
+		d.rec = make([]byte, size)
+	}
+	rec := d.rec[:size]
+	if _, err := io.ReadFull(d.r, rec); err != nil {
+		return fmt.Errorf("logger: зашифрованный файл обрезан: %w", io.ErrUnexpectedEOF)
+	}
+
+	switch typ {
+	case encRecordHeader:
+		if !bytes.HasPrefix(rec, []byte(encMagic)) || len(rec) < len(encMagic)+1 {
+			return ErrNotEncrypted
+		}
+		idLen := int(rec[len(encMagic)])
+		if len(rec) != len(encMagic)+1+idLen+encSaltLen {
+			return errors.New("logger: поврежденный заголовок зашифрованного файла")
+		}
+		if d.aead != nil && bytes.Equal(rec, d.header) {
+			return nil
+		}
+		id := string(rec[len(encMagic)+1 : len(encMagic)+1+idLen])
+		key, err := d.keys.Key(id)
+		if err != nil {
+			return err
+		}
+		aead, err := newGCM(key, rec[len(encMagic)+1+idLen:])
+		if err != nil {
+			return err
+		}
+		d.keyID, d.aead = id, aead
+		d.header = append(d.header[:0], rec...)
+		return nil
+	case encRecordFrame:
+		nonceSize := d.aead.NonceSize()
+		if len(rec) < nonceSize {
+			return errors.New("logger: поврежденный кадр зашифрованного файла")
+		}
+		plain, err := d.aead.Open(nil, rec[:nonceSize], rec[nonceSize:], []byte(d.keyID))
+		if err != nil {
+			return fmt.Errorf("logger: не удалось расшифровать кадр: %w", err)
+		}
+		d.buf = plain
+		return nil
+	default:
+		return fmt.Errorf("logger: неизвестный тип записи %q в зашифрованном файле", typ)
+	}
+}
+
+// OpenEncryptedLogFile открывает зашифрованный лог-файл, в том числе сжатый
+// бэкап, и возвращает поток расшифрованного текста.
+func OpenEncryptedLogFile(path string, keys KeyProvider) (io.ReadCloser, error) {
+	rc, err := OpenLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &stackedReadCloser{Reader: NewDecryptingReader(rc, keys), closers: []io.Closer{rc}}, nil
+}
@@ -0,0 +1,62 @@
+package logit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncryptionRekeysAfterFrameLimit(t *testing.T) {
+	defer func(n uint64) { encFramesPerKey = n }(encFramesPerKey)
+	encFramesPerKey = 2
+
+	keys := NewStaticKeys("k1", bytes.Repeat([]byte{7}, 32))
+	path := filepath.Join(t.TempDir(), "app.log")
+	w := NewTimeRotatingWriter(&lumberjack.Logger{Filename: path}, time.Hour, WithEncryption(keys))
+	var want bytes.Buffer
+	for i := 0; i < 5; i++ {
+		line := fmt.Sprintf("record %d\n", i)
+		want.WriteString(line)
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salts := map[string]bool{}
+	for rest := raw; len(rest) > 0; {
+		size := int(binary.BigEndian.Uint32(rest[1:]))
+		if rest[0] == encRecordHeader {
+			salts[string(rest[encPrefixLen+size-encSaltLen:encPrefixLen+size])] = true
+		}
+		rest = rest[encPrefixLen+size:]
+	}
+	if len(salts) != 3 {
+		t.Errorf("заголовков с разной солью: %d, ожидалось 3 (по одному на 2 кадра)", len(salts))
+	}
+
+	rc, err := OpenEncryptedLogFile(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("чтение: %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("расшифровано %q, ожидалось %q", got, want.String())
+	}
+}
@@ -0,0 +1,116 @@
+package logit
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxErrorStack - глубина стектрейса, сохраняемого в Error.
+const maxErrorStack = 32
+
+// Error - ошибка, которая запоминает в момент создания операцию из контекста,
+// стектрейс и поля. Logger.Error выводит стектрейс места создания самой
+// глубокой Error в цепочке вместо места вызова логгера; он же передается в
+// Sentry как стектрейс исключения.
+type Error struct {
+	op     string
+	msg    string
+	cause  error
+	stack  []uintptr
+	fields []zap.Field
+}
+
+// NewError создает ошибку с сообщением msg, операцией из ctx и полями fields.
+func NewError(ctx context.Context, msg string, fields ...zap.Field) error {
+	return newError(ctx, nil, msg, fields)
+}
+
+// Wrap оборачивает err, добавляя сообщение msg, операцию из ctx, стектрейс и
+// поля fields. Для nil возвращает nil, поэтому безопасен в `return logit.Wrap(ctx, err, ...)`.
+func Wrap(ctx context.Context, err error, msg string, fields ...zap.Field) error {
+	if err == nil {
+		return nil
+	}
+	return newError(ctx, err, msg, fields)
+}
+
+func newError(ctx context.Context, cause error, msg string, fields []zap.Field) *Error {
+	e := &Error{msg: msg, cause: cause, fields: fields}
+	if ctx != nil {
+		e.op, _ = ctx.Value(opKey).(string)
+	}
+	pcs := make([]uintptr, maxErrorStack)
+	// Пропускаем runtime.Callers, newError и NewError/Wrap.
+	e.stack = pcs[:runtime.Callers(3, pcs)]
+	return e
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.cause == nil:
+		return e.msg
+	case e.msg == "":
+		return e.cause.Error()
+	default:
+		return e.msg + ": " + e.cause.Error()
+	}
+}
+
+// Unwrap возвращает обернутую ошибку.
+func (e *Error) Unwrap() error { return e.cause }
+
+// Op возвращает операцию из контекста, в котором была создана ошибка.
+func (e *Error) Op() string { return e.op }
+
+// LogFields возвращает поля, переданные при создании ошибки.
+func (e *Error) LogFields() []zap.Field { return e.fields }
+
+// StackTrace возвращает адреса кадров места создания ошибки.
+// Метод с этим именем Sentry SDK использует как стектрейс исключения.
+func (e *Error) StackTrace() []uintptr { return e.stack }
+
+// originError возвращает самую глубокую Error в цепочке err - место, где
+// ошибка возникла, - или nil, если в цепочке нет Error.
+func originError(err error) *Error {
+	var origin *Error
+	for _, e := range unwrapChain(err) {
+		if le, ok := e.(*Error); ok {
+			origin = le
+		}
+	}
+	return origin
+}
+
+// originStack возвращает стектрейс originError(err) в формате стектрейсов zap
+// или пустую строку.
+func originStack(err error) string {
+	origin := originError(err)
+	if origin == nil || len(origin.stack) == 0 {
+		return ""
+	}
+	return formatStack(origin.stack)
+}
+
+// formatStack форматирует кадры так же, как zap: "функция\n\tфайл:строка".
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(frame.Function)
+		b.WriteString("\n\t")
+		b.WriteString(frame.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(frame.Line))
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package logit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Ключи полей, которые логгер извлекает из ошибки.
+const (
+	errorChainKey = "errorChain"
+	errorOpKey    = "errorOp"
+	errorCodeKey  = "errorCode"
+)
+
+// maxErrorChain ограничивает число ошибок в errorChain, чтобы зацикленная или
+// слишком глубокая цепочка не раздувала запись.
+const maxErrorChain = 32
+
+// FieldsCarrier реализуют доменные ошибки, которые несут структурированный
+// контекст. Поля всех ошибок цепочки попадают в запись и в событие Sentry;
+// при совпадении ключей побеждает внешняя ошибка.
+type FieldsCarrier interface {
+	LogFields() []zap.Field
+}
+
+// OpCarrier реализуют ошибки, знающие операцию, в которой они возникли.
+// Значение выводится в поле errorOp.
+type OpCarrier interface {
+	Op() string
+}
+
+// CodeCarrier реализуют ошибки с прикладным кодом. Значение выводится в поле errorCode.
+type CodeCarrier interface {
+	Code() string
+}
+
+// unwrapChain обходит цепочку err в глубину: errors.Unwrap и errors.Join
+// (Unwrap() []error). Внешняя ошибка идет первой.
+func unwrapChain(err error) []error {
+	var chain []error
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || len(chain) >= maxErrorChain {
+			return
+		}
+		chain = append(chain, err)
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// errorFields возвращает поля, извлеченные из ошибки: errorChain, errorOp,
+// errorCode и поля FieldsCarrier.
+func errorFields(err error) []zap.Field {
+	chain := unwrapChain(err)
+	if len(chain) == 0 {
+		return nil
+	}
+	fields := []zap.Field{zap.Array(errorChainKey, errorChain(chain))}
+
+	var op, code string
+	seen := make(map[string]struct{})
+	for _, e := range chain {
+		if c, ok := e.(OpCarrier); ok && op == "" {
+			op = c.Op()
+		}
+		if c, ok := e.(CodeCarrier); ok && code == "" {
+			code = c.Code()
+		}
+		if c, ok := e.(FieldsCarrier); ok {
+			for _, f := range c.LogFields() {
+				if _, dup := seen[f.Key]; dup {
+					continue
+				}
+				seen[f.Key] = struct{}{}
+				fields = append(fields, f)
+			}
+		}
+	}
+	if op != "" {
+		fields = append(fields, zap.String(errorOpKey, op))
+	}
+	if code != "" {
+		fields = append(fields, zap.String(errorCodeKey, code))
+	}
+	return fields
+}
+
+// errorChain кодирует цепочку ошибок как массив объектов {type, message}.
+type errorChain []error
+
+func (c errorChain) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, err := range c {
+		if err := enc.AppendObject(chainLink{err}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type chainLink struct {
+	err error
+}
+
+func (l chainLink) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", fmt.Sprintf("%T", l.err))
+	enc.AddString("message", l.err.Error())
+	if c, ok := l.err.(OpCarrier); ok && c.Op() != "" {
+		enc.AddString("op", c.Op())
+	}
+	if c, ok := l.err.(CodeCarrier); ok && c.Code() != "" {
+		enc.AddString("code", c.Code())
+	}
+	return nil
+}
+
+// capture отправляет ошибку в Sentry вместе с op, traceId и структурированными
+// полями записи (включая извлеченные из ошибки) в контексте "fields".
+func (l *logIt) capture(ctx context.Context, err error, fields []zap.Field) {
+	hub := sentry.CurrentHub()
+	if hub.Client() == nil {
+		return
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag(string(opKey), l.getOpFromContext(ctx))
+		scope.SetTag(string(traceIDKey), l.getTraceIDFromContext(ctx))
+		var target CodeCarrier
+		if errors.As(err, &target) && target.Code() != "" {
+			scope.SetTag(errorCodeKey, target.Code())
+		}
+		if len(fields) > 0 {
+			enc := zapcore.NewMapObjectEncoder()
+			for _, f := range l.secrets.fields(fields, false) {
+				if f.Type == zapcore.ErrorType && f.Key == errorKey {
+					continue // ошибка уже передается как исключение
+				}
+				f.AddTo(enc)
+			}
+			scope.SetContext("fields", enc.Fields)
+		}
+		if origin := originError(err); origin != nil && origin != err {
+			// Sentry добавляет внешней ошибке без стектрейса стек места вызова логгера;
+			// заменяем его местом создания ошибки.
+			scope.AddEventProcessor(func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+				if n := len(event.Exception); n > 0 {
+					event.Exception[n-1].Stacktrace = sentry.ExtractStacktrace(origin)
+				}
+				return event
+			})
+		}
+		hub.CaptureException(err)
+	})
+}
@@ -0,0 +1,251 @@
+package logit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net"
+	"strings"
+)
+
+const defaultFluentAddress = "127.0.0.1:24224"
+
+// FluentConf задает отправку записей в Fluentd/Fluent Bit по протоколу
+// Forward (тип вывода fluent).
+type FluentConf struct {
+	Network string `yaml:"network" json:"network"` // tcp (по умолчанию), tls или unix
+	// Address - host:port или путь сокета; по умолчанию 127.0.0.1:24224.
+	Address string `yaml:"address" json:"address"`
+	// TagPrefix - начало тега; по умолчанию AppConf.Name. Полный тег - <TagPrefix>.<уровень>.
+	TagPrefix string `yaml:"tagPrefix" json:"tagPrefix"`
+	// RequireAck включает подтверждение приема каждого пакета (опция chunk):
+	// неподтвержденный пакет отправляется повторно.
+	RequireAck bool       `yaml:"requireAck" json:"requireAck"`
+	TLS        *TLSConf   `yaml:"tls" json:"tls"`
+	Batch      *BatchConf `yaml:"batch" json:"batch"`
+}
+
+// newFluentCore создает ядро отправки по протоколу Forward в режиме PackedForward:
+// записи пакета с одним тегом передаются одним сообщением. Записи кодируются
+// кодировщиком json и перекодируются в MessagePack при отправке.
+func newFluentCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Fluent
+	if conf == nil {
+		conf = &FluentConf{}
+	}
+	if out.Encoder != "" && !strings.EqualFold(out.Encoder, EncoderJSON) {
+		return nil, fmt.Errorf("logger: вывод %q поддерживает только кодировщик json", OutputFluent)
+	}
+
+	network := strings.ToLower(conf.Network)
+	if network == "" {
+		network = "tcp"
+	}
+	address := conf.Address
+	if address == "" && network != "unix" {
+		address = defaultFluentAddress
+	}
+	if address == "" {
+		return nil, errors.New("logger: для fluent по unix нужен путь сокета (address)")
+	}
+	fwd := &fluentForward{requireAck: conf.RequireAck}
+	switch network {
+	case "tcp", "unix":
+		fwd.dial = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		}
+	case "tls":
+		tlsConfig, err := conf.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		fwd.dial = func(ctx context.Context) (net.Conn, error) {
+			d := tls.Dialer{Config: tlsConfig}
+			return d.DialContext(ctx, "tcp", address)
+		}
+	default:
+		return nil, fmt.Errorf("logger: неизвестный сетевой протокол fluent %q", conf.Network)
+	}
+
+	prefix := conf.TagPrefix
+	if prefix == "" {
+		prefix = params.AppConf.Name
+	}
+	prefix = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return '_'
+		}
+		return r
+	}, prefix)
+	tags := map[zapcore.Level]string{}
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		tags[lvl] = prefix + "." + lvl.String()
+	}
+
+	encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	b := newBatcher("Fluent "+network+"://"+address, conf.Batch, fwd.send, params.errorHandler())
+	b.closers = append(b.closers, fwd.close)
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          encoder,
+		key:          func(ent zapcore.Entry, _ []zapcore.Field) string { return tags[ent.Level] },
+		b:            b,
+	}, nil
+}
+
+// fluentForward отправляет пакеты через одно соединение. Используется только
+// горутиной batcher, поэтому синхронизация не нужна.
+type fluentForward struct {
+	dial       func(ctx context.Context) (net.Conn, error)
+	requireAck bool
+	conn       net.Conn
+}
+
+// send отправляет пакет: по сообщению PackedForward на каждый тег. После ошибки
+// соединение закрывается, и неотправленные сообщения повторяются через новое.
+func (f *fluentForward) send(ctx context.Context, batch []remoteEntry) error {
+	var order []string
+	groups := map[string][]remoteEntry{}
+	for _, e := range batch {
+		if _, ok := groups[e.key]; !ok {
+			order = append(order, e.key)
+		}
+		groups[e.key] = append(groups[e.key], e)
+	}
+	var msgs [][]byte
+	var chunks []string
+	for _, tag := range order {
+		msg, chunk, err := f.message(tag, groups[tag])
+		if err != nil {
+			return &permanentError{err}
+		}
+		msgs = append(msgs, msg)
+		chunks = append(chunks, chunk)
+	}
+
+	if f.conn == nil {
+		conn, err := f.dial(ctx)
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = f.conn.SetDeadline(deadline)
+	}
+	for i, msg := range msgs {
+		if err := f.write(msg, chunks[i]); err != nil {
+			_ = f.conn.Close()
+			f.conn = nil
+			if i == 0 {
+				return err
+			}
+			// Сообщения с предыдущими тегами уже отправлены, повторяем остальные.
+			var rest []remoteEntry
+			for _, tag := range order[i:] {
+				rest = append(rest, groups[tag]...)
+			}
+			return &partialError{entries: rest, err: err}
+		}
+	}
+	return nil
+}
+
+// close закрывает соединение после остановки batcher.
+func (f *fluentForward) close() error {
+	if f.conn == nil {
+		return nil
+	}
+	err := f.conn.Close()
+	f.conn = nil
+	return err
+}
+
+// message кодирует [tag, entries, option], где entries - последовательность
+// [EventTime, record], а option содержит size и, при RequireAck, chunk.
+func (f *fluentForward) message(tag string, entries []remoteEntry) ([]byte, string, error) {
+	var packed []byte
+	for _, e := range entries {
+		packed = appendMsgpackArrayHeader(packed, 2)
+		packed = appendMsgpackEventTime(packed, e.time)
+		var err error
+		if packed, err = appendMsgpackJSON(packed, e.data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var chunk string
+	options := 1
+	if f.requireAck {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		options++
+	}
+	msg := appendMsgpackArrayHeader(nil, 3)
+	msg = appendMsgpackString(msg, tag)
+	msg = appendMsgpackBinary(msg, packed)
+	msg = appendMsgpackMapHeader(msg, options)
+	msg = appendMsgpackString(msg, "size")
+	msg = appendMsgpackInt(msg, int64(len(entries)))
+	if chunk != "" {
+		msg = appendMsgpackString(msg, "chunk")
+		msg = appendMsgpackString(msg, chunk)
+	}
+	return msg, chunk, nil
+}
+
+// write отправляет сообщение и, если нужно, ждет ответа {"ack": chunk}.
+// Ожидание ограничено таймаутом отправки пакета (BatchConf.Timeout).
+func (f *fluentForward) write(msg []byte, chunk string) error {
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	ack, err := readFluentAck(f.conn)
+	if err != nil {
+		return fmt.Errorf("ожидание подтверждения: %w", err)
+	}
+	if ack != chunk {
+		return errors.New("подтвержден другой пакет")
+	}
+	return nil
+}
+
+// readFluentAck читает ответ {"ack": chunk} и возвращает chunk. Приемник может
+// закодировать строки любым строковым форматом MessagePack.
+func readFluentAck(r io.Reader) (string, error) {
+	n, err := readMsgpackMapHeader(r)
+	if err != nil {
+		return "", err
+	}
+	var ack string
+	for i := 0; i < n; i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		value, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		if key == "ack" {
+			ack = value
+		}
+	}
+	if ack == "" {
+		return "", errors.New("в ответе нет ack")
+	}
+	return ack, nil
+}
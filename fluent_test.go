@@ -0,0 +1,385 @@
+package logit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// decodeMsgpack читает одно значение MessagePack. Карты раскодируются в
+// map[string]any, EventTime (расширение 0) - в time.Time.
+func decodeMsgpack(r *bufio.Reader) (any, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	readUint := func(size int) (uint64, error) {
+		b, err := readN(size)
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		return v, nil
+	}
+	readString := func(n uint64) (any, error) {
+		b, err := readN(int(n))
+		return string(b), err
+	}
+	readArray := func(n uint64) (any, error) {
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	readMap := func(n uint64) (any, error) {
+		m := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("ключ карты %T", k)
+			}
+			if m[key], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	readExt := func(n int) (any, error) {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		b, err := readN(n)
+		if err != nil {
+			return nil, err
+		}
+		if typ != 0 || n != 8 {
+			return nil, fmt.Errorf("неожиданное расширение %d длины %d", typ, n)
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:]))), nil
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMap(uint64(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return readArray(uint64(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return readString(uint64(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(int(n))
+	case 0xca:
+		v, err := readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := readUint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := readUint(1 << (c - 0xcc))
+		return int64(v), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := readUint(size)
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, err
+	case 0xd7:
+		return readExt(8)
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readString(n)
+	case 0xdc, 0xdd:
+		n, err := readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readArray(n)
+	case 0xde, 0xdf:
+		n, err := readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMap(n)
+	}
+	return nil, fmt.Errorf("неподдерживаемый тип MessagePack 0x%x", c)
+}
+
+// forwardMessage - сообщение PackedForward, принятое тестовым сервером.
+type forwardMessage struct {
+	conn    int // номер соединения с 1
+	tag     string
+	times   []time.Time
+	records []map[string]any
+	options map[string]any
+}
+
+// forwardServer - сервер протокола Forward. Сообщения первых dropConns
+// соединений читаются, но не подтверждаются: соединение закрывается.
+type forwardServer struct {
+	ln        net.Listener
+	dropConns int
+	messages  chan forwardMessage
+	mu        sync.Mutex
+	errs      []error
+}
+
+func newForwardServer(t *testing.T, dropConns int) *forwardServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &forwardServer{ln: ln, dropConns: dropConns, messages: make(chan forwardMessage, 100)}
+	t.Cleanup(func() {
+		_ = ln.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, err := range s.errs {
+			t.Errorf("сервер Forward: %v", err)
+		}
+	})
+	go func() {
+		for n := 1; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, n)
+		}
+	}()
+	return s
+}
+
+func (s *forwardServer) fail(err error) {
+	s.mu.Lock()
+	s.errs = append(s.errs, err)
+	s.mu.Unlock()
+}
+
+func (s *forwardServer) serve(conn net.Conn, n int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.fail(err)
+			}
+			return
+		}
+		msg, err := parseForwardMessage(v)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		msg.conn = n
+		s.messages <- msg
+		if n <= s.dropConns {
+			return // без подтверждения
+		}
+		if chunk, ok := msg.options["chunk"].(string); ok {
+			// {"ack": chunk}; chunk кодируется str8, а не fixstr, как клиент.
+			ack := []byte{0x81, 0xa3, 'a', 'c', 'k', 0xd9, byte(len(chunk))}
+			if _, err := conn.Write(append(ack, chunk...)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseForwardMessage разбирает [tag, entries, option] режима PackedForward.
+func parseForwardMessage(v any) (forwardMessage, error) {
+	var msg forwardMessage
+	arr, ok := v.([]any)
+	if !ok || len(arr) != 3 {
+		return msg, fmt.Errorf("сообщение не массив из 3 элементов: %v", v)
+	}
+	tag, ok1 := arr[0].(string)
+	packed, ok2 := arr[1].([]byte)
+	options, ok3 := arr[2].(map[string]any)
+	if !ok1 || !ok2 || !ok3 {
+		return msg, fmt.Errorf("неожиданные типы элементов: %T, %T, %T", arr[0], arr[1], arr[2])
+	}
+	msg.tag, msg.options = tag, options
+	r := bufio.NewReader(bytes.NewReader(packed))
+	for {
+		e, err := decodeMsgpack(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return msg, err
+		}
+		entry, ok := e.([]any)
+		if !ok || len(entry) != 2 {
+			return msg, fmt.Errorf("запись не пара [time, record]: %v", e)
+		}
+		ts, ok1 := entry[0].(time.Time)
+		record, ok2 := entry[1].(map[string]any)
+		if !ok1 || !ok2 {
+			return msg, fmt.Errorf("неожиданные типы записи: %T, %T", entry[0], entry[1])
+		}
+		msg.times = append(msg.times, ts)
+		msg.records = append(msg.records, record)
+	}
+	if size, _ := options["size"].(int64); int(size) != len(msg.records) {
+		return msg, fmt.Errorf("size = %v, записей %d", options["size"], len(msg.records))
+	}
+	return msg, nil
+}
+
+func receiveForward(t *testing.T, s *forwardServer) forwardMessage {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("сообщение Forward не получено")
+		return forwardMessage{}
+	}
+}
+
+func newFluentTestLogger(t *testing.T, s *forwardServer, requireAck bool) Logger {
+	t.Helper()
+	return newOutputTestLogger(t, OutputConf{Type: OutputFluent, Fluent: &FluentConf{
+		Address:    s.ln.Addr().String(),
+		RequireAck: requireAck,
+		Batch:      testBatchConf(),
+	}})
+}
+
+func TestFluentPackedForwardWithAck(t *testing.T) {
+	srv := newForwardServer(t, 0)
+	l := newFluentTestLogger(t, srv, true)
+	start := time.Now()
+	ctx := context.Background()
+	l.Info(ctx, "first", Secret("password", "p"))
+	l.Warn(ctx, "warning")
+	l.Info(ctx, "second")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// Записи группируются по тегу в порядке первого появления.
+	want := []struct {
+		tag  string
+		msgs []string
+	}{
+		{"app.info", []string{"first", "second"}},
+		{"app.warn", []string{"warning"}},
+	}
+	for _, w := range want {
+		msg := receiveForward(t, srv)
+		if msg.tag != w.tag {
+			t.Errorf("тег %q, ожидался %q", msg.tag, w.tag)
+		}
+		if chunk, _ := msg.options["chunk"].(string); chunk == "" {
+			t.Errorf("%s: нет chunk при RequireAck", msg.tag)
+		}
+		if len(msg.records) != len(w.msgs) {
+			t.Fatalf("%s: записей %d, ожидалось %d", msg.tag, len(msg.records), len(w.msgs))
+		}
+		for i, text := range w.msgs {
+			rec := msg.records[i]
+			if rec["msg"] != text || rec["appName"] != "app" {
+				t.Errorf("%s: запись %d = %v", msg.tag, i, rec)
+			}
+			if ts := msg.times[i]; ts.Before(start.Add(-time.Second)) || ts.After(time.Now()) {
+				t.Errorf("%s: время записи %s", msg.tag, ts)
+			}
+		}
+	}
+}
+
+func TestFluentWithoutAck(t *testing.T) {
+	srv := newForwardServer(t, 0)
+	l := newFluentTestLogger(t, srv, false)
+	l.Info(context.Background(), "plain")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	msg := receiveForward(t, srv)
+	if _, ok := msg.options["chunk"]; ok || len(msg.options) != 1 {
+		t.Errorf("опции без RequireAck: %v", msg.options)
+	}
+	if len(msg.records) != 1 || msg.records[0]["msg"] != "plain" {
+		t.Errorf("записи %v", msg.records)
+	}
+}
+
+func TestFluentResendsAfterConnectionClosed(t *testing.T) {
+	// Первое соединение закрывается без подтверждения: пакет должен прийти
+	// повторно через новое соединение.
+	srv := newForwardServer(t, 1)
+	l := newFluentTestLogger(t, srv, true)
+	l.Info(context.Background(), "resent")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	first, second := receiveForward(t, srv), receiveForward(t, srv)
+	if first.conn != 1 || second.conn != 2 {
+		t.Errorf("соединения %d и %d, ожидались 1 и 2", first.conn, second.conn)
+	}
+	for _, msg := range []forwardMessage{first, second} {
+		if len(msg.records) != 1 || msg.records[0]["msg"] != "resent" {
+			t.Errorf("соединение %d: записи %v", msg.conn, msg.records)
+		}
+	}
+
+	// Следующие пакеты идут через новое соединение.
+	l.Info(context.Background(), "after")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if msg := receiveForward(t, srv); msg.conn != 2 || msg.records[0]["msg"] != "after" {
+		t.Errorf("после переподключения: соединение %d, записи %v", msg.conn, msg.records)
+	}
+	select {
+	case msg := <-srv.messages:
+		t.Errorf("лишнее сообщение: %+v", msg)
+	default:
+	}
+}
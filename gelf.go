@@ -0,0 +1,319 @@
+package logit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Сжатие сообщений GELF по UDP.
+const (
+	GELFCompressionGzip = "gzip"
+	GELFCompressionZlib = "zlib"
+	GELFCompressionNone = "none"
+)
+
+const (
+	defaultGELFAddress   = "127.0.0.1:12201"
+	defaultGELFChunkSize = 1420 // помещается в MTU с заголовками UDP/IP
+	gelfMaxChunks        = 128
+	gelfChunkHeader      = 12 // магические байты, идентификатор, номер и число частей
+)
+
+// GELFConf задает отправку записей в Graylog в формате GELF 1.1 (тип вывода gelf).
+type GELFConf struct {
+	Network string `yaml:"network" json:"network"` // udp (по умолчанию), tcp или tls
+	Address string `yaml:"address" json:"address"` // по умолчанию 127.0.0.1:12201
+	// Compression - сжатие для UDP: gzip (по умолчанию), zlib или none.
+	// По TCP сообщения не сжимаются.
+	Compression string `yaml:"compression" json:"compression"`
+	// ChunkSize - максимальный размер датаграммы UDP; большие сообщения делятся
+	// на части (не больше 128). По умолчанию 1420 байт.
+	ChunkSize int        `yaml:"chunkSize" json:"chunkSize"`
+	Host      string     `yaml:"host" json:"host"` // поле host; по умолчанию имя хоста
+	TLS       *TLSConf   `yaml:"tls" json:"tls"`
+	Batch     *BatchConf `yaml:"batch" json:"batch"`
+}
+
+// gelfStandard - поля GELF, которые передаются без префикса '_'.
+var gelfStandard = []string{"short_message", "full_message", "timestamp", "level"}
+
+// newGELFCore создает ядро отправки в Graylog. Уровень сопоставляется уровню
+// syslog, msg передается в short_message, стектрейс - в full_message,
+// остальные поля (op, traceId и поля записи) - дополнительными полями с '_'.
+func newGELFCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.GELF
+	if conf == nil {
+		conf = &GELFConf{}
+	}
+	if out.Encoder != "" || out.Profile != "" {
+		return nil, fmt.Errorf("logger: вывод %q не поддерживает encoder и profile", OutputGELF)
+	}
+	network := strings.ToLower(conf.Network)
+	if network == "" {
+		network = "udp"
+	}
+	address := conf.Address
+	if address == "" {
+		address = defaultGELFAddress
+	}
+	host := conf.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	g := &gelfSender{host: host, onError: params.errorHandler()}
+	switch network {
+	case "udp":
+		g.chunkSize = conf.ChunkSize
+		if g.chunkSize <= 0 {
+			g.chunkSize = defaultGELFChunkSize
+		}
+		if g.chunkSize <= gelfChunkHeader {
+			return nil, fmt.Errorf("logger: слишком маленький размер части GELF: %d", conf.ChunkSize)
+		}
+		g.compression = strings.ToLower(conf.Compression)
+		switch g.compression {
+		case "":
+			g.compression = GELFCompressionGzip
+		case GELFCompressionGzip, GELFCompressionZlib, GELFCompressionNone:
+		default:
+			return nil, fmt.Errorf("logger: неизвестное сжатие GELF %q", conf.Compression)
+		}
+		g.dial = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", address)
+		}
+	case "tcp":
+		g.stream = true
+		g.dial = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", address)
+		}
+	case "tls":
+		tlsConfig, err := conf.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		g.stream = true
+		g.dial = func(ctx context.Context) (net.Conn, error) {
+			d := tls.Dialer{Config: tlsConfig}
+			return d.DialContext(ctx, "tcp", address)
+		}
+	default:
+		return nil, fmt.Errorf("logger: неизвестный сетевой протокол GELF %q", conf.Network)
+	}
+
+	// Записи кодируются в JSON со стандартными ключами GELF; дополнительные поля
+	// получают префикс при отправке.
+	encoderConfig.MessageKey = "short_message"
+	encoderConfig.StacktraceKey = "full_message"
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendFloat64(float64(t.UnixMilli()) / 1000)
+	}
+	encoderConfig.LevelKey = "level"
+	encoderConfig.EncodeLevel = func(lvl zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendInt(syslogSeverity(lvl))
+	}
+	b := newBatcher("GELF "+network+"://"+address, conf.Batch, g.send, params.errorHandler())
+	b.closers = append(b.closers, g.close)
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          zapcore.NewJSONEncoder(encoderConfig),
+		key:          func(zapcore.Entry, []zapcore.Field) string { return "" },
+		b:            b,
+	}, nil
+}
+
+// gelfSender отправляет пакеты в одно соединение; используется только горутиной batcher.
+type gelfSender struct {
+	host        string
+	dial        func(ctx context.Context) (net.Conn, error)
+	stream      bool // tcp/tls: сообщения разделяются нулевым байтом
+	compression string
+	chunkSize   int
+	conn        net.Conn
+	onError     func(error)
+}
+
+func (g *gelfSender) send(ctx context.Context, batch []remoteEntry) error {
+	if g.conn == nil {
+		conn, err := g.dial(ctx)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = g.conn.SetDeadline(deadline)
+	}
+
+	// После ошибки повторяются только записи, которые не были отправлены целиком.
+	var stream []byte
+	var ends []int // конец сообщения каждой записи в stream
+	for i, e := range batch {
+		msg, err := gelfMessage(e.data, g.host)
+		if err != nil {
+			return &permanentError{err}
+		}
+		if g.stream {
+			stream = append(append(stream, msg...), 0)
+			ends = append(ends, len(stream))
+			continue
+		}
+		if err := g.writeDatagrams(msg); err != nil {
+			return &partialError{entries: batch[i:], err: g.fail(err)}
+		}
+	}
+	if g.stream {
+		if n, err := g.conn.Write(stream); err != nil {
+			sent := sort.SearchInts(ends, n+1)
+			return &partialError{entries: batch[sent:], err: g.fail(err)}
+		}
+	}
+	return nil
+}
+
+func (g *gelfSender) fail(err error) error {
+	_ = g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// close закрывает соединение после остановки batcher.
+func (g *gelfSender) close() error {
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// writeDatagrams сжимает сообщение и отправляет его одной датаграммой или частями.
+func (g *gelfSender) writeDatagrams(msg []byte) error {
+	data, err := g.compress(msg)
+	if err != nil {
+		return err
+	}
+	if len(data) <= g.chunkSize {
+		_, err := g.conn.Write(data)
+		return err
+	}
+
+	payload := g.chunkSize - gelfChunkHeader
+	count := (len(data) + payload - 1) / payload
+	if count > gelfMaxChunks {
+		// Повтор не поможет: сообщение отбрасывается, остальные отправляются.
+		g.onError(fmt.Errorf("logger: сообщение GELF (%d байт) не помещается в %d частей, отброшено", len(data), gelfMaxChunks))
+		return nil
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	chunk := make([]byte, 0, g.chunkSize)
+	for i := 0; i < count; i++ {
+		part := data[i*payload : min((i+1)*payload, len(data))]
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, part...)
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gelfSender) compress(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch g.compression {
+	case GELFCompressionGzip:
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(msg)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case GELFCompressionZlib:
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write(msg)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return msg, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// gelfMessage преобразует запись JSON в сообщение GELF 1.1: добавляет version и
+// host, а остальные поля передает дополнительными полями с префиксом '_'.
+// Значения дополнительных полей - строки или числа, поэтому вложенные объекты
+// и массивы передаются строкой JSON, а логические значения - строкой.
+func gelfMessage(data []byte, host string) ([]byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("разбор записи для GELF: %w", err)
+	}
+	if msg, ok := record["short_message"]; !ok || string(msg) == `""` {
+		record["short_message"] = json.RawMessage(`"-"`) // short_message обязателен
+	}
+
+	out := appendJSONString([]byte(`{"version":"1.1","host":`), host)
+	for _, key := range gelfStandard {
+		if v, ok := record[key]; ok {
+			out = appendJSONString(append(out, ','), key)
+			out = append(out, ':')
+			out = append(out, v...)
+			delete(record, key)
+		}
+	}
+
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := bytes.TrimSpace(record[k])
+		if len(v) == 0 {
+			continue
+		}
+		switch v[0] {
+		case 'n': // null
+			continue
+		case '{', '[', 't', 'f':
+			v = appendJSONString(nil, string(v))
+		}
+		out = appendJSONString(append(out, ','), gelfFieldName(k))
+		out = append(out, ':')
+		out = append(out, v...)
+	}
+	return append(out, '}'), nil
+}
+
+// gelfFieldName возвращает имя дополнительного поля: '_' и ключ, в котором
+// символы вне [A-Za-z0-9_.-] заменены на '_'. Поле _id зарезервировано.
+func gelfFieldName(key string) string {
+	name := "_" + strings.Map(func(r rune) rune {
+		if r < 128 && (isLower(byte(r)) || isUpper(byte(r)) || r >= '0' && r <= '9' || strings.ContainsRune("_.-", r)) {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "_id" {
+		return "__id"
+	}
+	return name
+}
@@ -0,0 +1,131 @@
+package logit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// limitedConn принимает не больше writes вызовов Write и bytes байт, затем
+// возвращает ошибку. Запись, упершаяся в лимит байт, принимается частично.
+type limitedConn struct {
+	net.Conn
+	writes int
+	bytes  int
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	if c.writes == 0 {
+		return 0, errors.New("write: broken pipe")
+	}
+	c.writes--
+	if len(p) > c.bytes {
+		n := c.bytes
+		c.buf.Write(p[:n])
+		c.bytes = 0
+		return n, errors.New("write: broken pipe")
+	}
+	c.bytes -= len(p)
+	c.buf.Write(p)
+	return len(p), nil
+}
+
+func (c *limitedConn) Close() error { c.closed = true; return nil }
+
+func (c *limitedConn) SetDeadline(time.Time) error { return nil }
+
+func gelfTestBatch(n int) []remoteEntry {
+	batch := make([]remoteEntry, n)
+	for i := range batch {
+		batch[i] = remoteEntry{data: []byte(fmt.Sprintf(`{"short_message":"m%d"}`, i))}
+	}
+	return batch
+}
+
+func newTestGELFSender(conn *limitedConn, stream bool) *gelfSender {
+	return &gelfSender{
+		host:        "host",
+		dial:        func(context.Context) (net.Conn, error) { return conn, nil },
+		stream:      stream,
+		compression: GELFCompressionNone,
+		chunkSize:   8192,
+		onError:     func(error) {},
+	}
+}
+
+func assertUnsent(t *testing.T, err error, batch []remoteEntry, from int) {
+	t.Helper()
+	var partial *partialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("ошибка %v, ожидалась partialError", err)
+	}
+	if len(partial.entries) != len(batch)-from {
+		t.Fatalf("к повтору %d записей, ожидалось %d", len(partial.entries), len(batch)-from)
+	}
+	for i, e := range partial.entries {
+		if !bytes.Equal(e.data, batch[from+i].data) {
+			t.Errorf("запись %d к повтору: %s, ожидалось %s", i, e.data, batch[from+i].data)
+		}
+	}
+}
+
+func TestGELFUDPFailureRetriesOnlyUnsent(t *testing.T) {
+	batch := gelfTestBatch(5)
+	conn := &limitedConn{writes: 2, bytes: 1 << 20}
+	g := newTestGELFSender(conn, false)
+
+	assertUnsent(t, g.send(context.Background(), batch), batch, 2)
+	if !conn.closed || g.conn != nil {
+		t.Error("соединение после ошибки должно быть закрыто")
+	}
+}
+
+func TestGELFStreamFailureRetriesOnlyUnsent(t *testing.T) {
+	batch := gelfTestBatch(5)
+	var size []int
+	for _, e := range batch {
+		msg, err := gelfMessage(e.data, "host")
+		if err != nil {
+			t.Fatal(err)
+		}
+		size = append(size, len(msg)+1)
+	}
+
+	cases := map[string]struct {
+		bytes int
+		from  int
+	}{
+		"nothing":       {0, 0},
+		"inside first":  {size[0] - 1, 0},
+		"two complete":  {size[0] + size[1], 2},
+		"inside third":  {size[0] + size[1] + 3, 2},
+		"all but delim": {size[0] + size[1] + size[2] + size[3] + size[4] - 1, 4},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			conn := &limitedConn{writes: 1, bytes: tc.bytes}
+			g := newTestGELFSender(conn, true)
+			assertUnsent(t, g.send(context.Background(), batch), batch, tc.from)
+			if !conn.closed || g.conn != nil {
+				t.Error("соединение после ошибки должно быть закрыто")
+			}
+		})
+	}
+}
+
+func TestGELFSendSuccess(t *testing.T) {
+	batch := gelfTestBatch(3)
+	conn := &limitedConn{writes: 1, bytes: 1 << 20}
+	if err := newTestGELFSender(conn, true).send(context.Background(), batch); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := bytes.Count(conn.buf.Bytes(), []byte{0}); got != len(batch) {
+		t.Errorf("отправлено %d сообщений, ожидалось %d", got, len(batch))
+	}
+}
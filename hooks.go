@@ -0,0 +1,83 @@
+package logit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RotatedFile описывает лог-файл, закрытый при ротации.
+// Path указывает на итоговый файл: после сжатия это сжатый бэкап.
+type RotatedFile struct {
+	Path     string
+	Size     int64
+	OpenedAt time.Time
+	ClosedAt time.Time
+}
+
+// RotationHook вызывается для каждого ротированного файла после его закрытия и сжатия.
+// Подходит для выгрузки в объектное хранилище, подсчета контрольных сумм или архивации.
+type RotationHook func(f RotatedFile) error
+
+// DirUploader копирует ротированные файлы в другой каталог
+// (например, смонтированное сетевое хранилище).
+type DirUploader struct {
+	Dir          string // Каталог назначения; создается при необходимости
+	RemoveSource bool   // Удалять исходный файл после успешного копирования
+}
+
+// NewDirUploader создает DirUploader для каталога dir.
+func NewDirUploader(dir string) *DirUploader {
+	return &DirUploader{Dir: dir}
+}
+
+// Upload копирует файл в каталог назначения. Копия сначала пишется во временный
+// файл и переименовывается, поэтому в каталоге назначения не бывает неполных файлов.
+// Метод подходит для использования в качестве RotationHook.
+func (u *DirUploader) Upload(f RotatedFile) error {
+	if err := os.MkdirAll(u.Dir, 0755); err != nil {
+		return err
+	}
+
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst := filepath.Join(u.Dir, filepath.Base(f.Path))
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("копирование %s: %w", f.Path, err)
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Chtimes(dst, f.ClosedAt, f.ClosedAt); err != nil {
+		return err
+	}
+
+	if u.RemoveSource {
+		_ = src.Close()
+		return os.Remove(f.Path)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package logit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJournalSocket - сокет нативного протокола systemd-journald.
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// maxJournalKey - максимальная длина имени поля журнала.
+const maxJournalKey = 64
+
+// JournaldConf задает вывод в systemd-journald (тип вывода journald).
+type JournaldConf struct {
+	Socket     string `yaml:"socket" json:"socket"`         // по умолчанию /run/systemd/journal/socket
+	Identifier string `yaml:"identifier" json:"identifier"` // SYSLOG_IDENTIFIER; по умолчанию AppConf.Name
+}
+
+// journalReserved - поля, которые заполняет сам вывод. Одноименные поля записи
+// получают префикс FIELD_.
+var journalReserved = map[string]bool{
+	"MESSAGE": true, "PRIORITY": true, "SYSLOG_IDENTIFIER": true,
+	"CODE_FILE": true, "CODE_LINE": true, "CODE_FUNC": true,
+	"STACKTRACE": true, "LOGGER": true,
+}
+
+// newJournaldCore создает ядро вывода в journald по нативному протоколу.
+// Если сокет журнала недоступен (контейнер, не-systemd система, не Linux),
+// записи пишутся в stdout в JSON.
+func newJournaldCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Journald
+	if conf == nil {
+		conf = &JournaldConf{}
+	}
+	socket := conf.Socket
+	if socket == "" {
+		socket = defaultJournalSocket
+	}
+
+	conn, err := openJournal(socket)
+	if err != nil {
+		encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+		if err != nil {
+			return nil, err
+		}
+		return zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), out.levelEnabler()), nil
+	}
+
+	identifier := conf.Identifier
+	if identifier == "" {
+		identifier = params.AppConf.Name
+	}
+	return &journaldCore{
+		LevelEnabler: out.levelEnabler(),
+		conn:         conn,
+		identifier:   identifier,
+		onError:      params.errorHandler(),
+		state:        &journalState{},
+	}, nil
+}
+
+// journaldCore отправляет каждую запись одной датаграммой: MESSAGE, PRIORITY,
+// SYSLOG_IDENTIFIER, место вызова и поля записи с именами в верхнем регистре
+// (traceId - TRACE_ID, appName - APP_NAME).
+type journaldCore struct {
+	zapcore.LevelEnabler
+	conn       *journalConn
+	identifier string
+	fields     []zapcore.Field // добавленные через With
+	onError    func(error)
+	state      *journalState // общее для всех ядер, полученных через With
+}
+
+// journalState отмечает, что о недоступности журнала уже сообщено.
+type journalState struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (c *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(append(clone.fields, c.fields...), fields...)
+	return &clone
+}
+
+func (c *journaldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journaldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	var data []byte
+	data = appendJournalField(data, "MESSAGE", ent.Message)
+	data = appendJournalField(data, "PRIORITY", strconv.Itoa(syslogSeverity(ent.Level)))
+	data = appendJournalField(data, "SYSLOG_IDENTIFIER", c.identifier)
+	if ent.LoggerName != "" {
+		data = appendJournalField(data, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		data = appendJournalField(data, "CODE_FILE", ent.Caller.File)
+		data = appendJournalField(data, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if ent.Caller.Function != "" {
+			data = appendJournalField(data, "CODE_FUNC", ent.Caller.Function)
+		}
+	}
+	if ent.Stack != "" {
+		data = appendJournalField(data, "STACKTRACE", ent.Stack)
+	}
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := journalKey(k)
+		if name == "" {
+			continue
+		}
+		if journalReserved[name] {
+			name = "FIELD_" + name
+		}
+		data = appendJournalField(data, name, journalValue(enc.Fields[k]))
+	}
+
+	// Как и в остальных сетевых выводах, о недоступности журнала сообщается
+	// один раз до восстановления, а не для каждой записи.
+	err := c.conn.send(data)
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	if err != nil && !c.state.down {
+		c.onError(fmt.Errorf("logger: запись в journald: %w", err))
+	}
+	c.state.down = err != nil
+	return nil
+}
+
+func (c *journaldCore) Sync() error {
+	return nil
+}
+
+// appendJournalField добавляет поле в формате нативного протокола: "KEY=value\n",
+// а для значений с переводом строки - имя, длина (uint64 little-endian) и значение.
+func appendJournalField(dst []byte, key, value string) []byte {
+	dst = append(dst, key...)
+	if !strings.ContainsRune(value, '\n') {
+		dst = append(dst, '=')
+		dst = append(dst, value...)
+		return append(dst, '\n')
+	}
+	dst = append(dst, '\n')
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(len(value)))
+	dst = append(dst, value...)
+	return append(dst, '\n')
+}
+
+// journalKey приводит ключ поля к имени поля журнала: верхний регистр, слова
+// camelCase разделяются '_' (HTTPStatus - HTTP_STATUS), прочие символы заменяются
+// на '_'. Имя не может начинаться с '_' (доверенные поля journald) и цифры.
+func journalKey(key string) string {
+	b := make([]byte, 0, len(key)+4)
+	for i := 0; i < len(key) && len(b) < maxJournalKey; i++ {
+		c := key[i]
+		switch {
+		case isLower(c):
+			b = append(b, c-'a'+'A')
+		case isUpper(c):
+			if len(b) > 0 && b[len(b)-1] != '_' && (isLower(key[i-1]) || i+1 < len(key) && isLower(key[i+1]) && isUpper(key[i-1])) {
+				b = append(b, '_')
+			}
+			b = append(b, c)
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	s := strings.TrimLeft(string(b), "_")
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "FIELD_" + s
+	}
+	if len(s) > maxJournalKey {
+		s = s[:maxJournalKey]
+	}
+	return s
+}
+
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+// journalValue форматирует значение поля: вложенные объекты и массивы - JSON.
+func journalValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
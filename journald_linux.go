@@ -0,0 +1,58 @@
+//go:build linux
+
+package logit
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// journalConn - датаграммное соединение с сокетом journald.
+type journalConn struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// openJournal подключается к сокету журнала.
+func openJournal(socket string) (*journalConn, error) {
+	if _, err := os.Stat(socket); err != nil {
+		return nil, err
+	}
+	// Неподключенный сокет: WriteMsgUnix с адресом работает и для передачи дескриптора.
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "journal")
+	defer f.Close()
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+	return &journalConn{conn: conn.(*net.UnixConn), addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}, nil
+}
+
+// send отправляет запись. Запись больше допустимого размера датаграммы
+// передается, как в sd_journal_send, дескриптором удаленного файла в /dev/shm.
+func (c *journalConn) send(data []byte) error {
+	_, _, err := c.conn.WriteMsgUnix(data, nil, c.addr)
+	if err == nil || !(errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)) {
+		return err
+	}
+
+	f, err := os.CreateTemp("/dev/shm", "logit-journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	_, _, err = c.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), c.addr)
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package logit
+
+import "errors"
+
+// journalConn недоступен вне Linux: вывод journald всегда пишет в stdout.
+type journalConn struct{}
+
+func openJournal(string) (*journalConn, error) {
+	return nil, errors.New("logger: journald поддерживается только в Linux")
+}
+
+func (c *journalConn) send([]byte) error {
+	return errors.New("logger: journald поддерживается только в Linux")
+}
@@ -0,0 +1,89 @@
+package logit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalKey(t *testing.T) {
+	for _, tt := range []struct {
+		key, want string
+	}{
+		{"traceId", "TRACE_ID"},
+		{"appName", "APP_NAME"},
+		{"HTTPStatus", "HTTP_STATUS"},
+		{"userID", "USER_ID"},
+		{"user_id", "USER_ID"},
+		{"http.method", "HTTP_METHOD"},
+		{"level", "LEVEL"},
+		{"_private", "PRIVATE"},
+		{"__cursor", "CURSOR"},
+		{"2fa", "FIELD_2FA"},
+		{"_9x", "FIELD_9X"},
+		{"ключ", ""},
+		{strings.Repeat("a", 100), strings.Repeat("A", maxJournalKey)},
+		{"1" + strings.Repeat("a", 70), "FIELD_1" + strings.Repeat("A", maxJournalKey-len("FIELD_1"))},
+	} {
+		if got := journalKey(tt.key); got != tt.want {
+			t.Errorf("journalKey(%q) = %q, ожидалось %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestAppendJournalField(t *testing.T) {
+	binaryField := func(key, value string) string {
+		b := binary.LittleEndian.AppendUint64([]byte(key+"\n"), uint64(len(value)))
+		return string(b) + value + "\n"
+	}
+	for _, tt := range []struct {
+		key, value, want string
+	}{
+		{"MESSAGE", "hello", "MESSAGE=hello\n"},
+		{"EMPTY", "", "EMPTY=\n"},
+		{"EQUALS", "a=b", "EQUALS=a=b\n"},
+		{"STACKTRACE", "line1\nline2", binaryField("STACKTRACE", "line1\nline2")},
+		{"TRAILING", "text\n", binaryField("TRAILING", "text\n")},
+	} {
+		if got := string(appendJournalField([]byte("PREV=1\n"), tt.key, tt.value)); got != "PREV=1\n"+tt.want {
+			t.Errorf("appendJournalField(%q, %q) = %q, ожидалось %q", tt.key, tt.value, got, "PREV=1\n"+tt.want)
+		}
+	}
+}
+
+func TestJournaldFallsBackToStdout(t *testing.T) {
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = stdout
+	t.Cleanup(func() {
+		os.Stdout = orig
+		_ = stdout.Close()
+	})
+
+	l := newOutputTestLogger(t, OutputConf{Type: OutputJournald, Journald: &JournaldConf{
+		Socket: filepath.Join(t.TempDir(), "missing.sock"),
+	}})
+	l.Info(context.Background(), "no journal")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	data, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("в stdout %q, ожидалась запись в JSON: %v", data, err)
+	}
+	if doc["msg"] != "no journal" {
+		t.Errorf("msg %v, ожидалось no journal", doc["msg"])
+	}
+}
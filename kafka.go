@@ -0,0 +1,122 @@
+package logit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"time"
+)
+
+const defaultKafkaFallbackFile = "kafka-fallback.log"
+
+// KafkaMessage - сообщение для отправки в Kafka.
+type KafkaMessage struct {
+	Topic string
+	Key   []byte // traceId записи; пустой, если его нет
+	Value []byte // запись, закодированная кодировщиком вывода
+	Time  time.Time
+}
+
+// KafkaProducer - продюсер Kafka, через который вывод kafka отправляет записи.
+// Логгер не зависит от клиента Kafka: достаточно адаптера к franz-go, sarama
+// или фейка в памяти для тестов.
+//
+// Produce синхронно отправляет пакет и вызывается из одной горутины. Если
+// доставлена только часть сообщений, Produce возвращает *KafkaProduceError
+// с номерами недоставленных.
+type KafkaProducer interface {
+	Produce(ctx context.Context, msgs []KafkaMessage) error
+}
+
+// KafkaProduceError - часть сообщений пакета не доставлена.
+type KafkaProduceError struct {
+	Failed []int // номера сообщений в пакете
+	Err    error
+}
+
+func (e *KafkaProduceError) Error() string {
+	return fmt.Sprintf("не доставлено сообщений Kafka: %d: %v", len(e.Failed), e.Err)
+}
+
+func (e *KafkaProduceError) Unwrap() error { return e.Err }
+
+// KafkaConf задает отправку записей в топик Kafka (тип вывода kafka).
+type KafkaConf struct {
+	Topic string `yaml:"topic" json:"topic"`
+	// Producer задается в коде: клиент Kafka создает и настраивает приложение.
+	Producer KafkaProducer `yaml:"-" json:"-"`
+	Batch    *BatchConf    `yaml:"batch" json:"batch"`
+	// FallbackFile - файл (относительно LoggerConf.Dir), в который пишутся записи,
+	// не доставленные продюсером после всех повторов; по умолчанию kafka-fallback.log.
+	FallbackFile string `yaml:"fallbackFile" json:"fallbackFile"`
+}
+
+// newKafkaCore создает ядро отправки в Kafka. Ключ сообщения - traceId, поэтому
+// записи одного запроса попадают в одну партицию и сохраняют порядок.
+// Записи кодируются кодировщиком вывода (по умолчанию json).
+func newKafkaCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Kafka
+	if conf == nil || conf.Topic == "" {
+		return nil, fmt.Errorf("logger: для вывода %q нужен топик (topic)", OutputKafka)
+	}
+	if conf.Producer == nil {
+		return nil, errors.New("logger: для вывода kafka не задан KafkaConf.Producer")
+	}
+	fallbackFile := conf.FallbackFile
+	if fallbackFile == "" {
+		fallbackFile = defaultKafkaFallbackFile
+	}
+
+	encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	topic, producer := conf.Topic, conf.Producer
+	send := func(ctx context.Context, batch []remoteEntry) error {
+		msgs := make([]KafkaMessage, len(batch))
+		for i, e := range batch {
+			msgs[i] = KafkaMessage{Topic: topic, Value: e.data, Time: e.time}
+			if e.key != "" {
+				msgs[i].Key = []byte(e.key)
+			}
+		}
+		err := producer.Produce(ctx, msgs)
+		var produceErr *KafkaProduceError
+		if errors.As(err, &produceErr) {
+			// Повторяем только недоставленные сообщения.
+			retry := make([]remoteEntry, 0, len(produceErr.Failed))
+			for _, i := range produceErr.Failed {
+				if i >= 0 && i < len(batch) {
+					retry = append(retry, batch[i])
+				}
+			}
+			if len(retry) == 0 {
+				return nil
+			}
+			return &partialError{entries: retry, err: err}
+		}
+		return err
+	}
+	b := newBatcher("Kafka "+topic, conf.Batch, send, params.errorHandler())
+	if err := b.setFallbackFile(params, fallbackFile); err != nil {
+		_ = b.close()
+		return nil, err
+	}
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          encoder,
+		key:          kafkaKey,
+		b:            b,
+	}, nil
+}
+
+// kafkaKey возвращает traceId записи из полей, добавленных contextFields.
+func kafkaKey(_ zapcore.Entry, fields []zapcore.Field) string {
+	for _, f := range fields {
+		if f.Key == string(traceIDKey) && f.Type == zapcore.StringType {
+			return f.String
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package logit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeKafkaProducer запоминает отправленные пакеты и возвращает ошибки,
+// которые задает result по номеру вызова.
+type fakeKafkaProducer struct {
+	mu     sync.Mutex
+	calls  [][]KafkaMessage
+	result func(call int, msgs []KafkaMessage) error
+}
+
+func (p *fakeKafkaProducer) Produce(_ context.Context, msgs []KafkaMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, append([]KafkaMessage(nil), msgs...))
+	if p.result == nil {
+		return nil
+	}
+	return p.result(len(p.calls)-1, msgs)
+}
+
+func (p *fakeKafkaProducer) produced() [][]KafkaMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]KafkaMessage(nil), p.calls...)
+}
+
+// kafkaMessages возвращает поле msg записей пакета.
+func kafkaMessages(t *testing.T, msgs []KafkaMessage) []string {
+	t.Helper()
+	var got []string
+	for _, m := range msgs {
+		var doc map[string]any
+		if err := json.Unmarshal(m.Value, &doc); err != nil {
+			t.Fatalf("сообщение %q: %v", m.Value, err)
+		}
+		got = append(got, doc["msg"].(string))
+	}
+	return got
+}
+
+func newKafkaTestLogger(t *testing.T, producer KafkaProducer, batch *BatchConf) (Logger, string) {
+	t.Helper()
+	params := newOutputTestParams(t, OutputConf{Type: OutputKafka, Kafka: &KafkaConf{
+		Topic:    "logs",
+		Producer: producer,
+		Batch:    batch,
+	}})
+	params.ErrorHandler = func(error) {}
+	return newParamsTestLogger(t, params), filepath.Join(params.LoggerConf.Dir, defaultKafkaFallbackFile)
+}
+
+func TestKafkaKeyIsTraceID(t *testing.T) {
+	producer := &fakeKafkaProducer{}
+	l, _ := newKafkaTestLogger(t, producer, testBatchConf())
+	traceID := "trace-1"
+	l.Info(l.NewCtx(context.Background(), "op", &traceID), "with-trace")
+	l.Info(context.Background(), "generated-trace")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	calls := producer.produced()
+	if len(calls) != 1 || len(calls[0]) != 2 {
+		t.Fatalf("пакеты %v, ожидался один из двух сообщений", calls)
+	}
+	for _, m := range calls[0] {
+		if m.Topic != "logs" {
+			t.Errorf("топик %q, ожидался logs", m.Topic)
+		}
+	}
+	if key := string(calls[0][0].Key); key != "trace-1" {
+		t.Errorf("ключ %q, ожидался traceId из контекста", key)
+	}
+	// Без traceId в контексте логгер создает его сам; ключ совпадает с полем записи.
+	var doc map[string]any
+	if err := json.Unmarshal(calls[0][1].Value, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if key := string(calls[0][1].Key); key == "" || key != doc[string(traceIDKey)] {
+		t.Errorf("ключ %q, ожидался traceId записи %v", key, doc[string(traceIDKey)])
+	}
+}
+
+func TestKafkaRetriesOnlyFailedMessages(t *testing.T) {
+	producer := &fakeKafkaProducer{result: func(call int, _ []KafkaMessage) error {
+		if call == 0 {
+			return &KafkaProduceError{Failed: []int{1, 3}, Err: errors.New("leader not available")}
+		}
+		return nil
+	}}
+	l, fallback := newKafkaTestLogger(t, producer, testBatchConf())
+	logMessages(l, "a", "b", "c", "d")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	calls := producer.produced()
+	if len(calls) != 2 {
+		t.Fatalf("вызовов Produce: %d, ожидалось 2", len(calls))
+	}
+	if got := strings.Join(kafkaMessages(t, calls[1]), ","); got != "b,d" {
+		t.Errorf("повторно отправлены %s, ожидались недоставленные b,d", got)
+	}
+	if msgs := fallbackMessages(t, fallback); len(msgs) != 0 {
+		t.Errorf("запасной файл: %v", msgs)
+	}
+}
+
+func TestKafkaSpillsToFallbackAfterRetries(t *testing.T) {
+	producer := &fakeKafkaProducer{result: func(int, []KafkaMessage) error {
+		return errors.New("broker down")
+	}}
+	batch := testBatchConf()
+	batch.MaxRetries = 2
+	l, fallback := newKafkaTestLogger(t, producer, batch)
+	logMessages(l, "a", "b")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := len(producer.produced()); n != 3 {
+		t.Errorf("вызовов Produce: %d, ожидалась попытка и два повтора", n)
+	}
+	if got := strings.Join(fallbackMessages(t, fallback), ","); got != "a,b" {
+		t.Errorf("в запасном файле %q, ожидались a,b", got)
+	}
+}
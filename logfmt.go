@@ -0,0 +1,554 @@
+package logit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+var (
+	logfmtBufferPool  = buffer.NewPool()
+	logfmtEncoderPool = sync.Pool{New: func() any { return &logfmtEncoder{} }}
+)
+
+// logfmtEncoder реализует zapcore.Encoder для формата logfmt.
+// Вложенные объекты и пространства имен разворачиваются в ключи через точку
+// (user.id=1), элементы массивов - в ключи с индексом (tags.0=a tags.1=b).
+// Значения с пробелами, кавычками, '=' и управляющими символами берутся в кавычки.
+type logfmtEncoder struct {
+	*zapcore.EncoderConfig
+	buf    *buffer.Buffer
+	prefix string // префикс ключей от открытых пространств имен и вложенных объектов
+
+	// reflectBuf и reflectEnc используются для AddReflected.
+	reflectBuf *buffer.Buffer
+	reflectEnc zapcore.ReflectedEncoder
+}
+
+// NewLogfmtEncoder создает кодировщик logfmt. Как и кодировщики zap, он использует
+// пулы для буферов и самих кодировщиков.
+func NewLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	enc := getLogfmtEncoder()
+	enc.EncoderConfig = &cfg
+	enc.buf = logfmtBufferPool.Get()
+	return enc
+}
+
+func getLogfmtEncoder() *logfmtEncoder {
+	return logfmtEncoderPool.Get().(*logfmtEncoder)
+}
+
+func putLogfmtEncoder(enc *logfmtEncoder) {
+	if enc.reflectBuf != nil {
+		enc.reflectBuf.Free()
+	}
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.prefix = ""
+	enc.reflectBuf = nil
+	enc.reflectEnc = nil
+	logfmtEncoderPool.Put(enc)
+}
+
+// Clone реализует zapcore.Encoder.
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	return enc.clone()
+}
+
+func (enc *logfmtEncoder) clone() *logfmtEncoder {
+	clone := getLogfmtEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.prefix = enc.prefix
+	clone.buf = logfmtBufferPool.Get()
+	_, _ = clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+// EncodeEntry реализует zapcore.Encoder.
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := getLogfmtEncoder()
+	final.EncoderConfig = enc.EncoderConfig
+	final.buf = logfmtBufferPool.Get()
+
+	if final.TimeKey != "" {
+		final.addKey(final.TimeKey)
+		if final.EncodeTime != nil {
+			final.EncodeTime(ent.Time, final.valueEncoder())
+		} else {
+			final.appendString(ent.Time.Format(time.RFC3339Nano))
+		}
+	}
+	if final.LevelKey != "" {
+		final.addKey(final.LevelKey)
+		if final.EncodeLevel != nil {
+			final.EncodeLevel(ent.Level, final.valueEncoder())
+		} else {
+			final.appendString(ent.Level.String())
+		}
+	}
+	if ent.LoggerName != "" && final.NameKey != "" {
+		final.addKey(final.NameKey)
+		if final.EncodeName != nil {
+			final.EncodeName(ent.LoggerName, final.valueEncoder())
+		} else {
+			final.appendString(ent.LoggerName)
+		}
+	}
+	if ent.Caller.Defined {
+		if final.CallerKey != "" {
+			final.addKey(final.CallerKey)
+			if final.EncodeCaller != nil {
+				final.EncodeCaller(ent.Caller, final.valueEncoder())
+			} else {
+				final.appendString(ent.Caller.TrimmedPath())
+			}
+		}
+		if final.FunctionKey != "" {
+			final.addKey(final.FunctionKey)
+			final.appendString(ent.Caller.Function)
+		}
+	}
+	if final.MessageKey != "" {
+		final.addKey(final.MessageKey)
+		final.appendString(ent.Message)
+	}
+
+	// Поля из With уже закодированы в enc.buf; префикс пространства имен
+	// продолжает действовать для полей записи.
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		_, _ = final.buf.Write(enc.buf.Bytes())
+	}
+	final.prefix = enc.prefix
+	for i := range fields {
+		fields[i].AddTo(final)
+	}
+	final.prefix = ""
+
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.addKey(final.StacktraceKey)
+		final.appendString(ent.Stack)
+	}
+
+	if final.LineEnding != "" {
+		final.buf.AppendString(final.LineEnding)
+	} else {
+		final.buf.AppendString(zapcore.DefaultLineEnding)
+	}
+
+	ret := final.buf
+	putLogfmtEncoder(final)
+	return ret, nil
+}
+
+// addKey пишет разделитель и ключ с учетом текущего префикса.
+func (enc *logfmtEncoder) addKey(key string) {
+	enc.addFullKey(enc.prefix + key)
+}
+
+func (enc *logfmtEncoder) addFullKey(key string) {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	if key == "" {
+		key = "_"
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			enc.buf.AppendByte('_')
+			continue
+		}
+		enc.buf.AppendByte(c)
+	}
+	enc.buf.AppendByte('=')
+}
+
+// OpenNamespace реализует zapcore.ObjectEncoder: все последующие ключи получают префикс key.
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "."
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	return enc.encodeArray(enc.prefix+key, arr)
+}
+
+func (enc *logfmtEncoder) encodeArray(fullKey string, arr zapcore.ArrayMarshaler) error {
+	ae := &logfmtArrayEncoder{enc: enc, key: fullKey}
+	err := arr.MarshalLogArray(ae)
+	if ae.n == 0 {
+		enc.addFullKey(fullKey)
+		enc.buf.AppendString("[]")
+	}
+	return err
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	return enc.encodeObject(enc.prefix+key+".", obj)
+}
+
+func (enc *logfmtEncoder) encodeObject(prefix string, obj zapcore.ObjectMarshaler) error {
+	old := enc.prefix
+	enc.prefix = prefix
+	err := obj.MarshalLogObject(enc)
+	enc.prefix = old
+	return err
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, val []byte) {
+	enc.addKey(key)
+	enc.appendByteString(val)
+}
+
+func (enc *logfmtEncoder) AddBool(key string, val bool) {
+	enc.addKey(key)
+	enc.buf.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, val complex128) {
+	enc.addKey(key)
+	enc.appendComplex(val, 64)
+}
+
+func (enc *logfmtEncoder) AddComplex64(key string, val complex64) {
+	enc.addKey(key)
+	enc.appendComplex(complex128(val), 32)
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, val time.Duration) {
+	enc.addKey(key)
+	enc.appendDuration(val)
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, val float64) {
+	enc.addKey(key)
+	enc.appendFloat(val, 64)
+}
+
+func (enc *logfmtEncoder) AddFloat32(key string, val float32) {
+	enc.addKey(key)
+	enc.appendFloat(float64(val), 32)
+}
+
+func (enc *logfmtEncoder) AddInt(key string, val int)     { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt32(key string, val int32) { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt16(key string, val int16) { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt8(key string, val int8)   { enc.AddInt64(key, int64(val)) }
+
+func (enc *logfmtEncoder) AddInt64(key string, val int64) {
+	enc.addKey(key)
+	enc.buf.AppendInt(val)
+}
+
+func (enc *logfmtEncoder) AddString(key, val string) {
+	enc.addKey(key)
+	enc.appendString(val)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, val time.Time) {
+	enc.addKey(key)
+	enc.appendTime(val)
+}
+
+func (enc *logfmtEncoder) AddUint(key string, val uint)       { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint32(key string, val uint32)   { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint16(key string, val uint16)   { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint8(key string, val uint8)     { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUintptr(key string, val uintptr) { enc.AddUint64(key, uint64(val)) }
+
+func (enc *logfmtEncoder) AddUint64(key string, val uint64) {
+	enc.addKey(key)
+	enc.buf.AppendUint(val)
+}
+
+// AddReflected кодирует произвольное значение в JSON и пишет его строкой.
+func (enc *logfmtEncoder) AddReflected(key string, obj any) error {
+	raw, err := enc.encodeReflected(obj)
+	if err != nil {
+		return err
+	}
+	enc.addKey(key)
+	enc.appendByteString(raw)
+	return nil
+}
+
+func (enc *logfmtEncoder) encodeReflected(obj any) ([]byte, error) {
+	if obj == nil {
+		return []byte("null"), nil
+	}
+	if enc.reflectBuf == nil {
+		enc.reflectBuf = logfmtBufferPool.Get()
+		if enc.EncoderConfig != nil && enc.NewReflectedEncoder != nil {
+			enc.reflectEnc = enc.NewReflectedEncoder(enc.reflectBuf)
+		} else {
+			jsonEnc := json.NewEncoder(enc.reflectBuf)
+			jsonEnc.SetEscapeHTML(false)
+			enc.reflectEnc = jsonEnc
+		}
+	} else {
+		enc.reflectBuf.Reset()
+	}
+	if err := enc.reflectEnc.Encode(obj); err != nil {
+		return nil, err
+	}
+	raw := enc.reflectBuf.Bytes()
+	if n := len(raw); n > 0 && raw[n-1] == '\n' {
+		raw = raw[:n-1] // json.Encoder добавляет перевод строки
+	}
+	return raw, nil
+}
+
+func (enc *logfmtEncoder) appendDuration(val time.Duration) {
+	if enc.EncoderConfig != nil && enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc.valueEncoder())
+		return
+	}
+	enc.appendString(val.String())
+}
+
+func (enc *logfmtEncoder) appendTime(val time.Time) {
+	if enc.EncoderConfig != nil && enc.EncodeTime != nil {
+		enc.EncodeTime(val, enc.valueEncoder())
+		return
+	}
+	enc.appendString(val.Format(time.RFC3339Nano))
+}
+
+func (enc *logfmtEncoder) appendFloat(val float64, bitSize int) {
+	switch {
+	case math.IsNaN(val):
+		enc.buf.AppendString("NaN")
+	case math.IsInf(val, 1):
+		enc.buf.AppendString("+Inf")
+	case math.IsInf(val, -1):
+		enc.buf.AppendString("-Inf")
+	default:
+		enc.buf.AppendFloat(val, bitSize)
+	}
+}
+
+func (enc *logfmtEncoder) appendComplex(val complex128, bitSize int) {
+	r, i := real(val), imag(val)
+	enc.buf.AppendFloat(r, bitSize)
+	if i >= 0 {
+		enc.buf.AppendByte('+')
+	}
+	enc.buf.AppendFloat(i, bitSize)
+	enc.buf.AppendByte('i')
+}
+
+// appendString пишет значение, при необходимости в кавычках с экранированием.
+func (enc *logfmtEncoder) appendString(s string) {
+	if !needsQuote(s) {
+		enc.buf.AppendString(s)
+		return
+	}
+	enc.buf.AppendByte('"')
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			enc.appendEscapedByte(b)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString("\ufffd")
+		} else {
+			enc.buf.AppendString(s[i : i+size])
+		}
+		i += size
+	}
+	enc.buf.AppendByte('"')
+}
+
+func (enc *logfmtEncoder) appendByteString(s []byte) {
+	enc.appendString(string(s))
+}
+
+func (enc *logfmtEncoder) appendEscapedByte(b byte) {
+	switch b {
+	case '\\', '"':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte(b)
+	case '\n':
+		enc.buf.AppendString(`\n`)
+	case '\r':
+		enc.buf.AppendString(`\r`)
+	case '\t':
+		enc.buf.AppendString(`\t`)
+	default:
+		if b < ' ' || b == 0x7f {
+			enc.buf.AppendString(`\u00`)
+			enc.buf.AppendByte(hexDigits[b>>4])
+			enc.buf.AppendByte(hexDigits[b&0xF])
+			return
+		}
+		enc.buf.AppendByte(b)
+	}
+}
+
+// needsQuote сообщает, нужно ли брать значение в кавычки.
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b <= ' ' || b == '=' || b == '"' || b == '\\' || b == 0x7f || b >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// valueEncoder возвращает PrimitiveArrayEncoder для функций EncodeTime, EncodeLevel
+// и т.п. из EncoderConfig: они пишут одно значение без ключа.
+func (enc *logfmtEncoder) valueEncoder() zapcore.PrimitiveArrayEncoder {
+	return &logfmtValueEncoder{enc: enc}
+}
+
+// logfmtValueEncoder пишет значения подряд; несколько значений разделяются запятой.
+type logfmtValueEncoder struct {
+	enc *logfmtEncoder
+	n   int
+}
+
+func (v *logfmtValueEncoder) sep() {
+	if v.n > 0 {
+		v.enc.buf.AppendByte(',')
+	}
+	v.n++
+}
+
+func (v *logfmtValueEncoder) AppendBool(val bool)             { v.sep(); v.enc.buf.AppendBool(val) }
+func (v *logfmtValueEncoder) AppendByteString(val []byte)     { v.sep(); v.enc.appendByteString(val) }
+func (v *logfmtValueEncoder) AppendComplex128(val complex128) { v.sep(); v.enc.appendComplex(val, 64) }
+func (v *logfmtValueEncoder) AppendComplex64(val complex64) {
+	v.sep()
+	v.enc.appendComplex(complex128(val), 32)
+}
+func (v *logfmtValueEncoder) AppendFloat64(val float64) { v.sep(); v.enc.appendFloat(val, 64) }
+func (v *logfmtValueEncoder) AppendFloat32(val float32) { v.sep(); v.enc.appendFloat(float64(val), 32) }
+func (v *logfmtValueEncoder) AppendInt(val int)         { v.AppendInt64(int64(val)) }
+func (v *logfmtValueEncoder) AppendInt64(val int64)     { v.sep(); v.enc.buf.AppendInt(val) }
+func (v *logfmtValueEncoder) AppendInt32(val int32)     { v.AppendInt64(int64(val)) }
+func (v *logfmtValueEncoder) AppendInt16(val int16)     { v.AppendInt64(int64(val)) }
+func (v *logfmtValueEncoder) AppendInt8(val int8)       { v.AppendInt64(int64(val)) }
+func (v *logfmtValueEncoder) AppendString(val string)   { v.sep(); v.enc.appendString(val) }
+func (v *logfmtValueEncoder) AppendUint(val uint)       { v.AppendUint64(uint64(val)) }
+func (v *logfmtValueEncoder) AppendUint64(val uint64)   { v.sep(); v.enc.buf.AppendUint(val) }
+func (v *logfmtValueEncoder) AppendUint32(val uint32)   { v.AppendUint64(uint64(val)) }
+func (v *logfmtValueEncoder) AppendUint16(val uint16)   { v.AppendUint64(uint64(val)) }
+func (v *logfmtValueEncoder) AppendUint8(val uint8)     { v.AppendUint64(uint64(val)) }
+func (v *logfmtValueEncoder) AppendUintptr(val uintptr) { v.AppendUint64(uint64(val)) }
+
+// logfmtArrayEncoder разворачивает элементы массива в ключи key.0, key.1, ...
+type logfmtArrayEncoder struct {
+	enc *logfmtEncoder
+	key string
+	n   int
+}
+
+func (a *logfmtArrayEncoder) next() string {
+	key := a.key + "." + strconv.Itoa(a.n)
+	a.n++
+	return key
+}
+
+func (a *logfmtArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	return a.enc.encodeArray(a.next(), arr)
+}
+
+func (a *logfmtArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	return a.enc.encodeObject(a.next()+".", obj)
+}
+
+func (a *logfmtArrayEncoder) AppendReflected(val any) error {
+	raw, err := a.enc.encodeReflected(val)
+	if err != nil {
+		return err
+	}
+	a.enc.addFullKey(a.next())
+	a.enc.appendByteString(raw)
+	return nil
+}
+
+func (a *logfmtArrayEncoder) AppendBool(val bool) {
+	a.enc.addFullKey(a.next())
+	a.enc.buf.AppendBool(val)
+}
+
+func (a *logfmtArrayEncoder) AppendByteString(val []byte) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendByteString(val)
+}
+
+func (a *logfmtArrayEncoder) AppendComplex128(val complex128) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendComplex(val, 64)
+}
+
+func (a *logfmtArrayEncoder) AppendComplex64(val complex64) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendComplex(complex128(val), 32)
+}
+
+func (a *logfmtArrayEncoder) AppendDuration(val time.Duration) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendDuration(val)
+}
+
+func (a *logfmtArrayEncoder) AppendFloat64(val float64) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendFloat(val, 64)
+}
+
+func (a *logfmtArrayEncoder) AppendFloat32(val float32) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendFloat(float64(val), 32)
+}
+
+func (a *logfmtArrayEncoder) AppendInt(val int)     { a.AppendInt64(int64(val)) }
+func (a *logfmtArrayEncoder) AppendInt32(val int32) { a.AppendInt64(int64(val)) }
+func (a *logfmtArrayEncoder) AppendInt16(val int16) { a.AppendInt64(int64(val)) }
+func (a *logfmtArrayEncoder) AppendInt8(val int8)   { a.AppendInt64(int64(val)) }
+
+func (a *logfmtArrayEncoder) AppendInt64(val int64) {
+	a.enc.addFullKey(a.next())
+	a.enc.buf.AppendInt(val)
+}
+
+func (a *logfmtArrayEncoder) AppendString(val string) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendString(val)
+}
+
+func (a *logfmtArrayEncoder) AppendTime(val time.Time) {
+	a.enc.addFullKey(a.next())
+	a.enc.appendTime(val)
+}
+
+func (a *logfmtArrayEncoder) AppendUint(val uint)       { a.AppendUint64(uint64(val)) }
+func (a *logfmtArrayEncoder) AppendUint32(val uint32)   { a.AppendUint64(uint64(val)) }
+func (a *logfmtArrayEncoder) AppendUint16(val uint16)   { a.AppendUint64(uint64(val)) }
+func (a *logfmtArrayEncoder) AppendUint8(val uint8)     { a.AppendUint64(uint64(val)) }
+func (a *logfmtArrayEncoder) AppendUintptr(val uintptr) { a.AppendUint64(uint64(val)) }
+
+func (a *logfmtArrayEncoder) AppendUint64(val uint64) {
+	a.enc.addFullKey(a.next())
+	a.enc.buf.AppendUint(val)
+}
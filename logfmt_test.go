@@ -0,0 +1,228 @@
+package logit
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logfmtPair - пара ключ-значение, разобранная из строки logfmt.
+type logfmtPair struct {
+	key, value string
+}
+
+// parseLogfmt разбирает строку, записанную logfmtEncoder. Значения в кавычках
+// раскодируются по правилам строковых литералов Go, которым следует кодировщик.
+func parseLogfmt(t *testing.T, line string) []logfmtPair {
+	t.Helper()
+	var pairs []logfmtPair
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		eq := strings.IndexByte(line[i:], '=')
+		if eq < 0 {
+			t.Fatalf("нет '=' после позиции %d: %q", i, line)
+		}
+		key := line[i : i+eq]
+		i += eq + 1
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for ; end < len(line); end++ {
+				if line[end] == '\\' {
+					end++
+					continue
+				}
+				if line[end] == '"' {
+					break
+				}
+			}
+			if end >= len(line) {
+				t.Fatalf("незакрытая кавычка: %q", line)
+			}
+			var err error
+			if value, err = strconv.Unquote(line[i : end+1]); err != nil {
+				t.Fatalf("раскодирование %s: %v", line[i:end+1], err)
+			}
+			i = end + 1
+		} else {
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				end = len(line) - i
+			}
+			value = line[i : i+end]
+			i += end
+		}
+		pairs = append(pairs, logfmtPair{key, value})
+	}
+	return pairs
+}
+
+func encodeLogfmt(t *testing.T, enc zapcore.Encoder, msg string, fields ...zapcore.Field) string {
+	t.Helper()
+	buf, err := enc.EncodeEntry(zapcore.Entry{Message: msg, Time: time.Unix(0, 0)}, fields)
+	if err != nil {
+		t.Fatalf("EncodeEntry: %v", err)
+	}
+	defer buf.Free()
+	line := buf.String()
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("запись должна занимать одну строку: %q", line)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func newTestLogfmtEncoder() zapcore.Encoder {
+	return NewLogfmtEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+}
+
+func TestLogfmtRoundTripStrings(t *testing.T) {
+	values := map[string]string{
+		"plain":     "value",
+		"empty":     "",
+		"space":     "hello world",
+		"equals":    "a=b",
+		"quote":     `say "hi"`,
+		"backslash": `C:\path\to`,
+		"newline":   "line1\nline2\r\n",
+		"tab":       "a\tb",
+		"control":   "bell\x07del\x7f",
+		"unicode":   "привет, 世界 🙂",
+		"mixed":     `k="v w" \n`,
+	}
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			line := encodeLogfmt(t, newTestLogfmtEncoder(), value, zap.String("v", value))
+			pairs := parseLogfmt(t, line)
+			want := []logfmtPair{{"msg", value}, {"v", value}}
+			if len(pairs) != len(want) {
+				t.Fatalf("%q: разобрано %v, ожидалось %v", line, pairs, want)
+			}
+			for i := range want {
+				if pairs[i] != want[i] {
+					t.Errorf("%q: пара %d = %q, ожидалось %q", line, i, pairs[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogfmtRoundTripInvalidUTF8(t *testing.T) {
+	line := encodeLogfmt(t, newTestLogfmtEncoder(), "m", zap.String("v", "a\xffb"))
+	pairs := parseLogfmt(t, line)
+	if got := pairs[1].value; got != "a\ufffdb" {
+		t.Errorf("v = %q, ожидалось замена на U+FFFD", got)
+	}
+}
+
+func TestLogfmtKeysAreSanitized(t *testing.T) {
+	line := encodeLogfmt(t, newTestLogfmtEncoder(), "m", zap.String("a key=\"x\"", "v"), zap.String("", "empty"))
+	want := []logfmtPair{{"msg", "m"}, {"a_key__x_", "v"}, {"_", "empty"}}
+	pairs := parseLogfmt(t, line)
+	if len(pairs) != len(want) {
+		t.Fatalf("%q: разобрано %v", line, pairs)
+	}
+	for i := range want {
+		if pairs[i] != want[i] {
+			t.Errorf("пара %d = %q, ожидалось %q", i, pairs[i], want[i])
+		}
+	}
+}
+
+type testUser struct {
+	ID   int
+	Name string
+	Tags []string
+}
+
+func (u testUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("id", u.ID)
+	enc.AddString("name", u.Name)
+	return enc.AddArray("tags", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, tag := range u.Tags {
+			arr.AppendString(tag)
+		}
+		return nil
+	}))
+}
+
+func TestLogfmtRoundTripNested(t *testing.T) {
+	enc := newTestLogfmtEncoder()
+	enc.OpenNamespace("req") // поля With и записи получают префикс req.
+	enc.AddString("id", "r 1")
+
+	line := encodeLogfmt(t, enc, "nested",
+		zap.Object("user", testUser{ID: 7, Name: "Иван Петров", Tags: []string{"a b", "c=d"}}),
+		zap.Ints("codes", []int{200, 404}),
+		zap.Strings("none", nil),
+		zap.Array("matrix", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			_ = arr.AppendArray(zapcore.ArrayMarshalerFunc(func(inner zapcore.ArrayEncoder) error {
+				inner.AppendInt(1)
+				inner.AppendString("x y")
+				return nil
+			}))
+			return arr.AppendObject(testUser{ID: 8})
+		})),
+		zap.Any("reflected", map[string]any{"k": "v w", "n": 1}),
+		zap.Bool("ok", true),
+		zap.Float64("ratio", 0.5),
+		zap.Duration("took", 1500*time.Millisecond),
+	)
+
+	want := []logfmtPair{
+		{"msg", "nested"},
+		{"req.id", "r 1"},
+		{"req.user.id", "7"},
+		{"req.user.name", "Иван Петров"},
+		{"req.user.tags.0", "a b"},
+		{"req.user.tags.1", "c=d"},
+		{"req.codes.0", "200"},
+		{"req.codes.1", "404"},
+		{"req.none", "[]"},
+		{"req.matrix.0.0", "1"},
+		{"req.matrix.0.1", "x y"},
+		{"req.matrix.1.id", "8"},
+		{"req.matrix.1.name", ""},
+		{"req.matrix.1.tags", "[]"},
+		{"req.reflected", `{"k":"v w","n":1}`},
+		{"req.ok", "true"},
+		{"req.ratio", "0.5"},
+		{"req.took", "1.5s"},
+	}
+	pairs := parseLogfmt(t, line)
+	if len(pairs) != len(want) {
+		t.Fatalf("%q:\nразобрано  %q\nожидалось %q", line, pairs, want)
+	}
+	for i := range want {
+		if pairs[i] != want[i] {
+			t.Errorf("пара %d = %q, ожидалось %q", i, pairs[i], want[i])
+		}
+	}
+}
+
+func TestLogfmtCloneKeepsFields(t *testing.T) {
+	parent := newTestLogfmtEncoder()
+	parent.AddString("app", "my app")
+	child := parent.Clone()
+	child.AddInt("n", 1)
+
+	if got := parseLogfmt(t, encodeLogfmt(t, parent, "p")); len(got) != 2 || got[1] != (logfmtPair{"app", "my app"}) {
+		t.Errorf("родитель: %q", got)
+	}
+	got := parseLogfmt(t, encodeLogfmt(t, child, "c"))
+	want := []logfmtPair{{"msg", "c"}, {"app", "my app"}, {"n", "1"}}
+	if len(got) != len(want) {
+		t.Fatalf("потомок: %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("потомок: пара %d = %q, ожидалось %q", i, got[i], want[i])
+		}
+	}
+}
@@ -8,9 +8,6 @@ import (
 	"github.com/x3a-tech/configo"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -22,8 +19,15 @@ const (
 	traceIDKey contextKey = "traceId"
 )
 
+// callerSkip - число кадров между кодом приложения и вызовом Check:
+// публичный метод logIt и logIt.log.
+const callerSkip = 2
+
 type logIt struct {
-	logger *zap.Logger
+	logger  *zap.Logger
+	secrets *secretRenderer // представление чувствительных полей в событиях Sentry
+	queues  []*batcher      // очереди удаленных выводов для Stats
+	closers []func()        // остановка фоновых горутин выводов, см. Close
 }
 
 // Logger определяет интерфейс для логгера.
@@ -49,6 +53,44 @@ type Params struct {
 	LoggerConf *configo.Logger
 	SenConf    *configo.Sentry
 	Env        *configo.Env // Убедитесь, что configo.Env существует и имеет метод IsLocal()
+
+	// Compression задает для файловых выводов сжатие ротированных файлов
+	// в фоновом воркере (gzip с уровнем, zstd). Если nil, используется встроенное gzip-сжатие lumberjack согласно LoggerConf.Compress.
+	Compression *CompressionConf
+	// RotationHooks вызываются для каждого ротированного файла после его закрытия и сжатия.
+	RotationHooks []RotationHook
+	// FileSync задает политику fsync для файловых выводов. Если nil, fsync выполняется
+	// только при явном вызове Sync и для уровней выше Error.
+	FileSync *SyncPolicy
+	// Outputs - декларативный список выводов, каждый со своим назначением, диапазоном
+	// уровней, кодировщиком и ротацией. Если пуст, выводы строятся из
+	// LoggerConf.EnableConsole/EnableFile.
+	Outputs []OutputConf
+	// Redaction задает правила редактирования персональных данных и секретов в полях
+	// и сообщениях. Применяется ко всем выводам и к событиям Sentry.
+	Redaction *RedactionConf
+	// Secrets задает вывод значений Secret и Sensitive: заглушка (по умолчанию)
+	// или отпечаток HMAC.
+	Secrets *SecretConf
+	// SentrySpool включает дисковую очередь для событий Sentry: события пишутся
+	// на диск и отправляются фоновой горутиной с повторами, поэтому переживают
+	// недоступность Sentry и перезапуск процесса. Каталог по умолчанию -
+	// spool/sentry. nil - события отправляет транспорт SDK с очередью в памяти.
+	SentrySpool *SpoolConf
+	// SentryBatch задает повторы и таймауты отправки событий из SentrySpool.
+	SentryBatch *BatchConf
+	// Audit задает файл журнала аудита для MustNewAuditor.
+	Audit *AuditConf
+	// Encryption включает шифрование файловых выводов AES-GCM статическим ключом
+	// из конфигурации. KeyProvider используется, если Encryption не задан,
+	// например, для ключей из KMS или хранилища секретов.
+	Encryption  *EncryptionConf
+	KeyProvider KeyProvider
+	// EnableCaller добавляет в записи место вызова (файл:строка) и имя функции.
+	EnableCaller bool
+	// ErrorHandler получает внутренние ошибки логгера (например, ошибки сжатия).
+	// Если nil, ошибки пишутся в os.Stderr.
+	ErrorHandler func(error)
 }
 
 // MustNewLogger создает новый экземпляр Logger.
@@ -74,14 +116,28 @@ func MustNewLogger(params *Params) Logger {
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace", // Ключ для стектрейса
 		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder, // Цветной вывод уровня для консоли
+		EncodeLevel:    zapcore.CapitalLevelEncoder, // Цвет выбирается кодировщиком вывода
 		EncodeTime:     zapcore.TimeEncoderOfLayout(params.LoggerConf.TimeFormat),
 		EncodeDuration: zapcore.StringDurationEncoder,
-		// EncodeCaller:   zapcore.ShortCallerEncoder, // Раскомментируйте, если нужен вывод места вызова. Потребуется zap.AddCaller() и возможно zap.AddCallerSkip().
+		CallerKey:      "caller", // Выводится только при Params.EnableCaller
+		FunctionKey:    "func",
+		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
 
-	var encoder zapcore.Encoder
+	secrets, err := newSecretRenderer(params.Secrets)
+	if err != nil {
+		panic(err.Error())
+	}
+	var redact *redactor
+	if params.Redaction != nil {
+		if redact, err = newRedactor(params.Redaction); err != nil {
+			panic(err.Error())
+		}
+	}
 
+	var queues []*batcher
+	var closers []func()
+	spoolDirs := map[string]bool{}
 	if !params.Env.IsLocal() {
 		if params.SenConf != nil && params.SenConf.Key != "" && params.SenConf.Host != "" {
 			// Sentry DSN формат: "https://<key>@<host>/<project_id>"
@@ -89,89 +145,98 @@ func MustNewLogger(params *Params) Logger {
 			// и если нужен ID проекта, он должен быть частью Host или добавлен отдельно.
 			// Текущая строка: fmt.Sprintf("https://%s@%s", params.SenConf.Key, params.SenConf.Host)
 			// может потребовать корректировки в зависимости от вашей конфигурации Sentry.
-			err := sentry.Init(sentry.ClientOptions{
+			options := sentry.ClientOptions{
 				Dsn:              fmt.Sprintf("https://%s@%s", params.SenConf.Key, params.SenConf.Host),
 				TracesSampleRate: 1.0,                  // Отправлять 100% трейсов, настройте по необходимости
 				Debug:            params.Env.IsLocal(), // Включать Debug для Sentry только в локальном окружении
 				Environment:      params.Env.String(),
 				Release:          fmt.Sprintf("%s@%s", params.AppConf.Name, params.AppConf.Version),
-			})
+			}
+			if redact != nil {
+				// Те же правила, что и для выводов, применяются к событиям Sentry.
+				options.BeforeSend = func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+					return redact.redactEvent(event)
+				}
+			}
+			var transport *sentryTransport
+			if params.SentrySpool != nil {
+				transport = newSentryTransport(params)
+				options.Transport = transport
+			}
+			err := sentry.Init(options)
 
 			if err != nil {
 				// Вместо паники можно логировать ошибку стандартным логгером и продолжить без Sentry
-				fmt.Fprintf(os.Stderr, "Ошибка инициализации Sentry: %v\n", err)
+				fmt.Fprintf(stderr, "Ошибка инициализации Sentry: %v\n", err)
 				// panic("Ошибка инициализации Sentry: " + err.Error()) // Или оставить панику, если Sentry критичен
+				if transport != nil {
+					transport.close()
+				}
+			} else if transport != nil {
+				// Спул запускается после Configure: события прошлых запусков
+				// отправляются сразу.
+				dir := params.spoolDir(OutputConf{Type: "sentry", Spool: params.SentrySpool})
+				spoolDirs[dir] = true
+				if err := transport.b.startSpool(dir, params.SentrySpool); err != nil {
+					panic(err.Error())
+				}
+				queues = append(queues, transport.b)
+				closers = append(closers, transport.close)
 			}
 		}
-		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder // Для JSON логов цвета не нужны
-		encoder = zapcore.NewJSONEncoder(encoderConfig)
-	} else {
-		encoder = zapcore.NewConsoleEncoder(encoderConfig) // Цветной вывод для локальной консоли
 	}
 
-	var cores []zapcore.Core
-
-	if params.LoggerConf.EnableConsole {
-		consoleWriter := zapcore.Lock(os.Stdout)
-		cores = append(cores, zapcore.NewCore(encoder, consoleWriter, zapcore.Level(params.LoggerConf.ConsoleLevel)))
+	outputs := params.outputs()
+	if len(outputs) == 0 {
+		// Если не настроен ни один вывод, логирование не будет работать.
+		// Это явная ошибка конфигурации.
+		panic("logger: не включен ни консольный, ни файловый вывод логов.")
 	}
 
-	if params.LoggerConf.EnableFile {
-		rotationTime, err := time.ParseDuration(params.LoggerConf.RotationTime)
+	// Каждый вывод получает собственный кодировщик и диапазон уровней.
+	var cores []zapcore.Core
+	for _, out := range outputs {
+		core, err := newOutputCore(params, out, encoderConfig)
 		if err != nil {
-			panic("Некорректное время ротации (RotationTime): " + err.Error() + ". Используйте формат вроде '24h', '5m'.")
+			panic(err.Error())
 		}
-
-		// Имя файла для lumberjack. Lumberjack будет ротировать этот файл.
-		// Если fileName включает дату, то каждый день будет создаваться новый *базовый* файл,
-		// и lumberjack будет ротировать уже его.
-		// TimeRotatingWriter затем будет принудительно ротировать этот файл по времени.
-		// Если нужен один непрерывный лог-файл, ротируемый по времени и размеру,
-		// то дата в fileName может быть избыточной.
-		// Текущая реализация fileName создает новый файл каждый день.
-		logFilePath := filepath.Join(params.LoggerConf.Dir, fileName(params.AppConf.Name, params.AppConf.Version))
-
-		lumberjackLogger := &lumberjack.Logger{
-			Filename:   logFilePath,
-			MaxSize:    params.LoggerConf.MaxSize, // в мегабайтах
-			MaxBackups: params.LoggerConf.MaxBackups,
-			MaxAge:     params.LoggerConf.MaxAge, // в днях
-			Compress:   params.LoggerConf.Compress,
-		}
-
-		var writer zapcore.WriteSyncer
-		if rotationTime > 0 {
-			timeRotatingWriter := NewTimeRotatingWriter(lumberjackLogger, rotationTime)
-			writer = zapcore.AddSync(timeRotatingWriter)
-		} else {
-			writer = zapcore.AddSync(lumberjackLogger) // Используем только lumberjack если rotationTime не задан (или 0)
+		if remote, ok := core.(*remoteCore); ok {
+			if out.Spool != nil {
+				dir := params.spoolDir(out)
+				if spoolDirs[dir] {
+					panic(fmt.Sprintf("logger: каталог спула %s используется несколькими выводами", dir))
+				}
+				spoolDirs[dir] = true
+				if err := remote.b.startSpool(dir, out.Spool); err != nil {
+					panic(err.Error())
+				}
+			}
+			queues = append(queues, remote.b)
+		} else if out.Spool != nil {
+			panic(fmt.Sprintf("logger: вывод %q не поддерживает спул", out.Type))
 		}
-		cores = append(cores, zapcore.NewCore(encoder, writer, zapcore.Level(params.LoggerConf.FileLevel)))
-	}
-
-	if len(cores) == 0 {
-		// Если не включен ни консольный, ни файловый вывод, логирование не будет работать.
-		// Можно либо запаниковать, либо по умолчанию включить консольный вывод.
-		// Здесь мы создадим Nop-логгер, чтобы приложение не падало, но логи не писались.
-		// Либо можно добавить ядро по умолчанию:
-		// consoleWriter := zapcore.Lock(os.Stdout)
-		// cores = append(cores, zapcore.NewCore(encoder, consoleWriter, zapcore.InfoLevel))
-		// fmt.Fprintln(os.Stderr, "Внимание: логирование не настроено (ни консоль, ни файл), используется NopLogger.")
-		// return NewNopLogger()
-		// Пока оставим панику, если нет ядер, это явная ошибка конфигурации.
-		if !params.LoggerConf.EnableConsole && !params.LoggerConf.EnableFile {
-			panic("logger: не включен ни консольный, ни файловый вывод логов.")
+		if c, ok := core.(interface{ close() }); ok {
+			closers = append(closers, c.close)
 		}
+		// Значения Secret и Sensitive раскрываются только в локальной консоли
+		// сборки с тегом logit_reveal.
+		reveal := revealSecrets && out.Type == OutputConsole && params.Env.IsLocal()
+		cores = append(cores, newSecretCore(core, secrets, reveal))
 	}
 
 	core := zapcore.NewTee(cores...)
+	if redact != nil {
+		// Редактирование выполняется один раз на запись, до кодирования во все выводы.
+		core = newRedactCore(core, redact)
+	}
 
-	// zap.AddCaller() - добавляет информацию о файле и строке вызова.
-	// zap.AddCallerSkip(1) - если обертка логгера состоит из одного уровня,
-	// нужно пропустить 1 уровень стека, чтобы показать реальное место вызова.
-	// Настройте skipCount, если у вас несколько уровней оберток.
-	// logger := zap.New(core, zap.AddStacktrace(zapcore.ErrorLevel), zap.AddCaller(), zap.AddCallerSkip(1))
-	logger := zap.New(core, zap.AddStacktrace(zapcore.ErrorLevel)) // Добавляем AddCaller и AddCallerSkip при необходимости
+	// zap.AddCallerSkip(callerSkip) пропускает кадры оберток logIt, поэтому и место
+	// вызова, и стектрейс начинаются с кода приложения.
+	options := []zap.Option{zap.AddStacktrace(zapcore.ErrorLevel), zap.AddCallerSkip(callerSkip)}
+	if params.EnableCaller {
+		options = append(options, zap.AddCaller())
+	}
+	logger := zap.New(core, options...)
 
 	// Добавляем стандартные поля
 	fields := []zap.Field{
@@ -185,7 +250,59 @@ func MustNewLogger(params *Params) Logger {
 
 	logger = logger.With(fields...)
 
-	return &logIt{logger: logger}
+	return &logIt{logger: logger, secrets: secrets, queues: queues, closers: closers}
+}
+
+// errorHandler возвращает обработчик внутренних ошибок логгера.
+func (p *Params) errorHandler() func(error) {
+	if p.ErrorHandler != nil {
+		return p.ErrorHandler
+	}
+	return stderrErrorHandler
+}
+
+// Sync сбрасывает буферы выводов: дожидается отправки накопленных записей
+// в удаленные приемники (не дольше их таймаута) и вызывает fsync для файлов.
+// Вызывайте перед завершением процесса. Для логгеров, созданных не через
+// MustNewLogger, ничего не делает.
+func Sync(l Logger) error {
+	li, ok := l.(*logIt)
+	if !ok {
+		return nil
+	}
+	return li.logger.Sync()
+}
+
+// Close сбрасывает буферы выводов, как Sync, останавливает их фоновые горутины
+// (fsync по интервалу, отправку в удаленные приемники) и закрывает соединения
+// и файлы. Записи, которые не удалось отправить до закрытия, передаются
+// запасному выводу или остаются в спуле. Вызывайте, когда логгер больше не
+// нужен; дочерние логгеры (With, WithCallerSkip) закрываются вместе с ним.
+func Close(l Logger) error {
+	li, ok := l.(*logIt)
+	if !ok {
+		return nil
+	}
+	err := li.logger.Sync()
+	for _, c := range li.closers {
+		c()
+	}
+	return err
+}
+
+// Stats возвращает состояние очередей удаленных выводов (Loki, Elasticsearch,
+// webhook и т.п.) в порядке Params.Outputs, например для экспорта в метрики.
+// Для логгеров, созданных не через MustNewLogger, возвращает nil.
+func Stats(l Logger) []QueueStats {
+	li, ok := l.(*logIt)
+	if !ok {
+		return nil
+	}
+	stats := make([]QueueStats, 0, len(li.queues))
+	for _, b := range li.queues {
+		stats = append(stats, b.stats())
+	}
+	return stats
 }
 
 // NewNopLogger создает логгер, который ничего не делает. Полезен для тестов.
@@ -197,99 +314,44 @@ func NewNopLogger() Logger {
 
 // Debug - логирование отладочной информации (структурированное)
 func (l *logIt) Debug(ctx context.Context, message string, fields ...zap.Field) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	allFields := append([]zap.Field{
-		zap.String(string(opKey), op),
-		zap.String(string(traceIDKey), traceID),
-	}, fields...)
-	l.logger.Debug(message, allFields...)
+	l.log(ctx, zapcore.DebugLevel, message, fields, nil)
 }
 
 func (l *logIt) Info(ctx context.Context, message string, fields ...zap.Field) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	l.logger.Info(
-		message,
-		append([]zap.Field{
-			zap.String(string(opKey), op),
-			zap.String(string(traceIDKey), traceID),
-		}, fields...)...,
-	)
+	l.log(ctx, zapcore.InfoLevel, message, fields, nil)
 }
 
 func (l *logIt) Infof(ctx context.Context, message string, a ...any) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	l.logger.Info(
-		fmt.Sprintf(message, a...),
-		zap.String(string(opKey), op),
-		zap.String(string(traceIDKey), traceID),
-	)
+	l.log(ctx, zapcore.InfoLevel, fmt.Sprintf(message, a...), nil, nil)
 }
 
 func (l *logIt) Warn(ctx context.Context, message string, fields ...zap.Field) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	l.logger.Warn(
-		message,
-		append([]zap.Field{
-			zap.String(string(opKey), op),
-			zap.String(string(traceIDKey), traceID),
-		}, fields...)...,
-	)
+	l.log(ctx, zapcore.WarnLevel, message, fields, nil)
 }
 
 func (l *logIt) Warnf(ctx context.Context, message string, a ...any) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	l.logger.Warn(
-		fmt.Sprintf(message, a...),
-		zap.String(string(opKey), op),
-		zap.String(string(traceIDKey), traceID),
-	)
+	l.log(ctx, zapcore.WarnLevel, fmt.Sprintf(message, a...), nil, nil)
 }
 
 func (l *logIt) Error(ctx context.Context, err error, fields ...zap.Field) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	// Добавляем само сообщение об ошибке как поле, если его нет в fields
+	// Добавляем саму ошибку и извлеченные из ее цепочки поля.
 	// Zap автоматически добавляет стектрейс для ErrorLevel и выше, если настроено AddStacktrace.
-	l.logger.Error(
-		err.Error(), // Сообщение ошибки
-		append([]zap.Field{
-			zap.String(string(opKey), op),
-			zap.String(string(traceIDKey), traceID),
-			zap.Error(err), // Добавляем саму ошибку как структурированное поле
-		}, fields...)...,
-	)
-	sentry.CaptureException(err) // Отправляем ошибку в Sentry
+	ctx = l.ensureTrace(ctx)
+	fields = append(append([]zap.Field{zap.Error(err)}, errorFields(err)...), fields...)
+	l.log(ctx, zapcore.ErrorLevel, err.Error(), fields, err)
+	l.capture(ctx, err, fields) // Отправляем ошибку в Sentry
 }
 
 func (l *logIt) Errorf(ctx context.Context, format string, args ...interface{}) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
 	err := fmt.Errorf(format, args...)
-	l.logger.Error(
-		err.Error(),
-		zap.String(string(opKey), op),
-		zap.String(string(traceIDKey), traceID),
-		zap.Error(err),
-	)
-	sentry.CaptureException(err)
+	ctx = l.ensureTrace(ctx)
+	fields := append([]zap.Field{zap.Error(err)}, errorFields(err)...)
+	l.log(ctx, zapcore.ErrorLevel, err.Error(), fields, err)
+	l.capture(ctx, err, fields)
 }
 
 func (l *logIt) Fatal(ctx context.Context, err error, fields ...zap.Field) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
-	l.logger.Fatal(
-		err.Error(),
-		append([]zap.Field{
-			zap.String(string(opKey), op),
-			zap.String(string(traceIDKey), traceID),
-			zap.Error(err),
-		}, fields...)...,
-	)
+	l.log(ctx, zapcore.FatalLevel, err.Error(), append(append([]zap.Field{zap.Error(err)}, errorFields(err)...), fields...), err)
 	// Sentry.CaptureException(err) здесь не нужен, т.к. Fatal завершит программу,
 	// и Sentry SDK обычно перехватывает паники/фатальные ошибки, если настроен.
 	// Однако, для явности или если есть специфические требования к flush Sentry перед выходом,
@@ -299,19 +361,36 @@ func (l *logIt) Fatal(ctx context.Context, err error, fields ...zap.Field) {
 }
 
 func (l *logIt) Fatalf(ctx context.Context, format string, args ...interface{}) {
-	op := l.getOpFromContext(ctx)
-	traceID := l.getTraceIDFromContext(ctx)
 	err := fmt.Errorf(format, args...)
-	l.logger.Fatal(
-		err.Error(),
-		zap.String(string(opKey), op),
-		zap.String(string(traceIDKey), traceID),
-		zap.Error(err),
-	)
+	l.log(ctx, zapcore.FatalLevel, err.Error(), append([]zap.Field{zap.Error(err)}, errorFields(err)...), err)
 	// sentry.CaptureException(err)
 	// sentry.Flush(2 * time.Second)
 }
 
+// log пишет запись с op и traceId из контекста. Вызывается только напрямую
+// из публичных методов logIt: на этом основан расчет callerSkip.
+// Если err содержит Error, стектрейс записи заменяется местом создания ошибки.
+func (l *logIt) log(ctx context.Context, lvl zapcore.Level, message string, fields []zap.Field, err error) {
+	ce := l.logger.Check(lvl, message)
+	if ce == nil {
+		return
+	}
+	if ce.Stack != "" && err != nil {
+		if stack := originStack(err); stack != "" {
+			ce.Stack = stack
+		}
+	}
+	ce.Write(l.contextFields(ctx, fields)...)
+}
+
+// contextFields возвращает op и traceId из контекста, за которыми следуют fields.
+func (l *logIt) contextFields(ctx context.Context, fields []zap.Field) []zap.Field {
+	return append([]zap.Field{
+		zap.String(string(opKey), l.getOpFromContext(ctx)),
+		zap.String(string(traceIDKey), l.getTraceIDFromContext(ctx)),
+	}, fields...)
+}
+
 // NewCtx создает новый контекст с указанной операцией и traceId.
 // Если ctx равен nil, используется context.Background().
 func (l *logIt) NewCtx(ctx context.Context, op string, traceID *string) context.Context {
@@ -371,6 +450,18 @@ func (l *logIt) NewTraceContext(traceID *string) context.Context {
 	return context.WithValue(context.Background(), traceIDKey, currentTraceID)
 }
 
+// ensureTrace гарантирует наличие traceId в контексте, чтобы запись и событие
+// Sentry получили один и тот же идентификатор.
+func (l *logIt) ensureTrace(ctx context.Context) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey, uuid.New().String())
+}
+
 // getOpFromContext извлекает операцию (op) из контекста.
 func (l *logIt) getOpFromContext(ctx context.Context) string {
 	if ctx == nil {
@@ -0,0 +1,276 @@
+package logit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Кодирование запросов к Loki.
+const (
+	LokiProtobuf = "protobuf" // protobuf со сжатием snappy
+	LokiJSON     = "json"
+)
+
+// Метки потока Loki, которые можно взять из конфигурации логгера.
+const (
+	LokiLabelApp     = "app"     // AppConf.Name
+	LokiLabelVersion = "version" // AppConf.Version
+	LokiLabelEnv     = "env"     // Env
+	LokiLabelLevel   = "level"   // уровень записи
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiConf задает отправку записей в Grafana Loki (тип вывода loki).
+type LokiConf struct {
+	// URL - адрес Loki, например http://loki:3100. Если путь не указан,
+	// используется /loki/api/v1/push.
+	URL      string `yaml:"url" json:"url"`
+	Encoding string `yaml:"encoding" json:"encoding"` // protobuf (по умолчанию) или json
+	// Labels - метки потока из app, version, env, level; по умолчанию app, env, level.
+	// Поля с большим числом значений (traceId, userId) остаются в строке записи.
+	Labels      []string          `yaml:"labels" json:"labels"`
+	ExtraLabels map[string]string `yaml:"extraLabels" json:"extraLabels"` // постоянные метки
+	TenantID    string            `yaml:"tenantId" json:"tenantId"`       // заголовок X-Scope-OrgID
+	Username    string            `yaml:"username" json:"username"`       // basic auth
+	Password    string            `yaml:"password" json:"password"`
+	Headers     map[string]string `yaml:"headers" json:"headers"`
+	TLS         *TLSConf          `yaml:"tls" json:"tls"`
+	Batch       *BatchConf        `yaml:"batch" json:"batch"`
+}
+
+// newLokiCore создает ядро отправки в Loki. Записи группируются в потоки по
+// меткам и отправляются пакетами; строка записи кодируется кодировщиком
+// вывода (по умолчанию json).
+func newLokiCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Loki
+	if conf == nil || conf.URL == "" {
+		return nil, fmt.Errorf("logger: для вывода %q нужен адрес Loki (url)", OutputLoki)
+	}
+	pushURL, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("logger: некорректный адрес Loki: %w", err)
+	}
+	if pushURL.Path == "" || pushURL.Path == "/" {
+		pushURL.Path = lokiPushPath
+	}
+
+	encoding := strings.ToLower(conf.Encoding)
+	switch encoding {
+	case "":
+		encoding = LokiProtobuf
+	case LokiProtobuf, LokiJSON:
+	default:
+		return nil, fmt.Errorf("logger: неизвестное кодирование Loki %q", conf.Encoding)
+	}
+
+	labels := map[string]string{}
+	for name, value := range conf.ExtraLabels {
+		if !validLabelName(name) {
+			return nil, fmt.Errorf("logger: некорректное имя метки Loki %q", name)
+		}
+		labels[name] = value
+	}
+	names := conf.Labels
+	if names == nil {
+		names = []string{LokiLabelApp, LokiLabelEnv, LokiLabelLevel}
+	}
+	byLevel := false
+	for _, name := range names {
+		switch name {
+		case LokiLabelApp:
+			labels[name] = params.AppConf.Name
+		case LokiLabelVersion:
+			labels[name] = params.AppConf.Version
+		case LokiLabelEnv:
+			labels[name] = params.Env.String()
+		case LokiLabelLevel:
+			byLevel = true
+		default:
+			return nil, fmt.Errorf("logger: неизвестная метка Loki %q", name)
+		}
+	}
+
+	// Наборы меток известны заранее: по одному на уровень или один общий.
+	pusher := &lokiPusher{url: pushURL.String(), json: encoding == LokiJSON, streams: map[string]map[string]string{}}
+	keys := map[zapcore.Level]string{}
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		stream := labels
+		if byLevel {
+			stream = make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				stream[k] = v
+			}
+			stream[LokiLabelLevel] = lvl.String()
+		}
+		key := lokiLabels(stream)
+		keys[lvl] = key
+		pusher.streams[key] = stream
+	}
+
+	pusher.client, err = httpClient(conf.TLS, 0)
+	if err != nil {
+		return nil, err
+	}
+	pusher.header = http.Header{}
+	for k, v := range conf.Headers {
+		pusher.header.Set(k, v)
+	}
+	if conf.TenantID != "" {
+		pusher.header.Set("X-Scope-OrgID", conf.TenantID)
+	}
+	if conf.Username != "" {
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(conf.Username, conf.Password)
+		pusher.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+	if pusher.json {
+		pusher.header.Set("Content-Type", "application/json")
+	} else {
+		pusher.header.Set("Content-Type", "application/x-protobuf")
+	}
+
+	encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	b := newBatcher("Loki "+pusher.url, conf.Batch, pusher.push, params.errorHandler())
+	b.closers = append(b.closers, closeIdle(pusher.client))
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          encoder,
+		key:          func(ent zapcore.Entry, _ []zapcore.Field) string { return keys[ent.Level] },
+		b:            b,
+	}, nil
+}
+
+// validLabelName проверяет имя метки: [a-zA-Z_][a-zA-Z0-9_]*.
+func validLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(isLower(c) || isUpper(c) || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// lokiLabels форматирует набор меток как селектор {a="1", b="2"}.
+func lokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// lokiPusher отправляет пакеты в push API Loki.
+type lokiPusher struct {
+	url     string
+	client  *http.Client
+	header  http.Header
+	json    bool
+	streams map[string]map[string]string // метки по ключу записи
+}
+
+// push группирует записи пакета по потокам, сохраняя порядок, и отправляет их одним запросом.
+func (p *lokiPusher) push(ctx context.Context, batch []remoteEntry) error {
+	var order []string
+	groups := map[string][]remoteEntry{}
+	for _, e := range batch {
+		if _, ok := groups[e.key]; !ok {
+			order = append(order, e.key)
+		}
+		groups[e.key] = append(groups[e.key], e)
+	}
+
+	var body []byte
+	if p.json {
+		type stream struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		}
+		req := struct {
+			Streams []stream `json:"streams"`
+		}{}
+		for _, key := range order {
+			s := stream{Stream: p.streams[key]}
+			for _, e := range groups[key] {
+				s.Values = append(s.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), string(e.data)})
+			}
+			req.Streams = append(req.Streams, s)
+		}
+		var err error
+		if body, err = json.Marshal(req); err != nil {
+			return &permanentError{err}
+		}
+	} else {
+		var req []byte
+		for _, key := range order {
+			req = appendProtoBytes(req, 1, lokiStream(key, groups[key]))
+		}
+		body = snappy.Encode(nil, req)
+	}
+
+	_, err := postHTTP(ctx, p.client, p.url, p.header, body)
+	return err
+}
+
+// lokiStream кодирует StreamAdapter: labels = 1, entries = 2
+// (EntryAdapter: timestamp = 1, line = 2).
+func lokiStream(labels string, entries []remoteEntry) []byte {
+	var stream []byte
+	stream = appendProtoBytes(stream, 1, []byte(labels))
+	for _, e := range entries {
+		var ts []byte
+		if sec := e.time.Unix(); sec != 0 {
+			ts = appendProtoVarint(ts, 1, uint64(sec))
+		}
+		if nanos := e.time.Nanosecond(); nanos != 0 {
+			ts = appendProtoVarint(ts, 2, uint64(nanos))
+		}
+		var entry []byte
+		entry = appendProtoBytes(entry, 1, ts)
+		entry = appendProtoBytes(entry, 2, e.data)
+		stream = appendProtoBytes(stream, 2, entry)
+	}
+	return stream
+}
+
+// appendProtoVarint добавляет поле protobuf типа varint.
+func appendProtoVarint(dst []byte, field int, v uint64) []byte {
+	dst = binary.AppendUvarint(dst, uint64(field)<<3)
+	return binary.AppendUvarint(dst, v)
+}
+
+// appendProtoBytes добавляет поле protobuf с разделителем длины (строка, байты, сообщение).
+func appendProtoBytes(dst []byte, field int, v []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(field)<<3|2)
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+	return append(dst, v...)
+}
@@ -0,0 +1,359 @@
+package logit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/klauspost/compress/snappy"
+	"github.com/x3a-tech/configo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBatchConf - пакетная отправка для тестов: пакет уходит по Sync, паузы
+// между повторами короткие.
+func testBatchConf() *BatchConf {
+	return &BatchConf{
+		Interval:   time.Hour,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		Timeout:    2 * time.Second,
+	}
+}
+
+// newOutputTestLogger создает логгер с единственным выводом out.
+func newOutputTestLogger(t *testing.T, out OutputConf) Logger {
+	t.Helper()
+	return newParamsTestLogger(t, newOutputTestParams(t, out))
+}
+
+// newOutputTestParams возвращает параметры логгера с единственным выводом out
+// и временным каталогом логов.
+func newOutputTestParams(t *testing.T, out OutputConf) *Params {
+	t.Helper()
+	env := configo.Env("prod")
+	return &Params{
+		AppConf:    &configo.App{Name: "app", Version: "1.2"},
+		LoggerConf: &configo.Logger{Dir: t.TempDir()},
+		Env:        &env,
+		Outputs:    []OutputConf{out},
+	}
+}
+
+// newParamsTestLogger создает логгер и закрывает его по завершении теста.
+func newParamsTestLogger(t *testing.T, params *Params) Logger {
+	t.Helper()
+	l := MustNewLogger(params)
+	t.Cleanup(func() { _ = Close(l) })
+	return l
+}
+
+// recordedRequest - запрос, полученный тестовым сервером.
+type recordedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// recordingServer записывает запросы и отвечает кодами из statuses по очереди;
+// после их исчерпания отвечает 204.
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+	statuses []int
+}
+
+func newRecordingServer(t *testing.T, statuses ...int) *recordingServer {
+	t.Helper()
+	s := &recordingServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, recordedRequest{path: r.URL.Path, header: r.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *recordingServer) recorded() []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]recordedRequest(nil), s.requests...)
+}
+
+// protoField - поле сообщения protobuf: varint или данные с разделителем длины.
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// parseProto разбирает сообщение protobuf с полями varint и length-delimited.
+func parseProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("некорректный тег protobuf")
+		}
+		b = b[n:]
+		f := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			if f.varint, n = binary.Uvarint(b); n <= 0 {
+				t.Fatalf("некорректный varint поля %d", f.num)
+			}
+			b = b[n:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				t.Fatalf("некорректная длина поля %d", f.num)
+			}
+			f.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("неожиданный тип поля %d: %d", f.num, tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// lokiTestStream - поток из запроса push.
+type lokiTestStream struct {
+	labels string
+	times  []time.Time
+	lines  []string
+}
+
+// decodeLokiProtobuf раскодирует PushRequest, сжатый snappy.
+func decodeLokiProtobuf(t *testing.T, body []byte) []lokiTestStream {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+	var streams []lokiTestStream
+	for _, sf := range parseProto(t, raw) {
+		if sf.num != 1 {
+			t.Fatalf("неожиданное поле PushRequest %d", sf.num)
+		}
+		var s lokiTestStream
+		for _, f := range parseProto(t, sf.bytes) {
+			switch f.num {
+			case 1:
+				s.labels = string(f.bytes)
+			case 2:
+				var ts time.Time
+				for _, ef := range parseProto(t, f.bytes) {
+					switch ef.num {
+					case 1:
+						var sec, nanos int64
+						for _, tf := range parseProto(t, ef.bytes) {
+							if tf.num == 1 {
+								sec = int64(tf.varint)
+							} else {
+								nanos = int64(tf.varint)
+							}
+						}
+						ts = time.Unix(sec, nanos)
+					case 2:
+						s.lines = append(s.lines, string(ef.bytes))
+					}
+				}
+				s.times = append(s.times, ts)
+			}
+		}
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+func checkLokiTime(t *testing.T, ts, start time.Time) {
+	t.Helper()
+	if ts.Before(start.Add(-time.Second)) || ts.After(time.Now().Add(time.Second)) {
+		t.Errorf("время записи %s вне интервала теста", ts)
+	}
+}
+
+func TestLokiPushProtobuf(t *testing.T) {
+	srv := newRecordingServer(t)
+	l := newOutputTestLogger(t, OutputConf{Type: OutputLoki, Loki: &LokiConf{
+		URL:         srv.URL,
+		ExtraLabels: map[string]string{"region": `eu "west"`},
+		TenantID:    "tenant-1",
+		Username:    "user",
+		Password:    "pass",
+		Headers:     map[string]string{"X-Custom": "1"},
+		Batch:       testBatchConf(),
+	}})
+	start := time.Now()
+	ctx := context.Background()
+	l.Info(ctx, "first")
+	l.Warn(ctx, "second")
+	l.Info(ctx, "third")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 1 {
+		t.Fatalf("запросов: %d, ожидался один", len(reqs))
+	}
+	req := reqs[0]
+	if req.path != lokiPushPath {
+		t.Errorf("путь %q", req.path)
+	}
+	wantHeaders := map[string]string{
+		"Content-Type":  "application/x-protobuf",
+		"X-Scope-Orgid": "tenant-1",
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")),
+		"X-Custom":      "1",
+	}
+	for k, v := range wantHeaders {
+		if got := req.header.Get(k); got != v {
+			t.Errorf("заголовок %s = %q, ожидалось %q", k, got, v)
+		}
+	}
+
+	streams := decodeLokiProtobuf(t, req.body)
+	want := []struct {
+		labels string
+		lines  []string
+	}{
+		{`{app="app", env="prod", level="info", region="eu \"west\""}`, []string{"first", "third"}},
+		{`{app="app", env="prod", level="warn", region="eu \"west\""}`, []string{"second"}},
+	}
+	if len(streams) != len(want) {
+		t.Fatalf("потоков: %d, ожидалось %d: %+v", len(streams), len(want), streams)
+	}
+	for i, w := range want {
+		s := streams[i]
+		if s.labels != w.labels {
+			t.Errorf("поток %d: метки %s, ожидалось %s", i, s.labels, w.labels)
+		}
+		if len(s.lines) != len(w.lines) {
+			t.Fatalf("поток %d: строк %d, ожидалось %d", i, len(s.lines), len(w.lines))
+		}
+		for j, msg := range w.lines {
+			var line map[string]any
+			if err := json.Unmarshal([]byte(s.lines[j]), &line); err != nil {
+				t.Fatalf("строка %q не JSON: %v", s.lines[j], err)
+			}
+			if !strings.Contains(s.lines[j], `"`+msg+`"`) || line["appName"] != "app" {
+				t.Errorf("поток %d, строка %d: %s", i, j, s.lines[j])
+			}
+			checkLokiTime(t, s.times[j], start)
+		}
+	}
+}
+
+func TestLokiPushJSON(t *testing.T) {
+	srv := newRecordingServer(t)
+	l := newOutputTestLogger(t, OutputConf{Type: OutputLoki, Loki: &LokiConf{
+		URL:      srv.URL + "/custom/push",
+		Encoding: LokiJSON,
+		Labels:   []string{LokiLabelApp, LokiLabelVersion},
+		Batch:    testBatchConf(),
+	}})
+	start := time.Now()
+	l.Info(context.Background(), "info")
+	l.Error(context.Background(), io.ErrUnexpectedEOF)
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 1 {
+		t.Fatalf("запросов: %d, ожидался один", len(reqs))
+	}
+	if reqs[0].path != "/custom/push" || reqs[0].header.Get("Content-Type") != "application/json" {
+		t.Errorf("путь %q, Content-Type %q", reqs[0].path, reqs[0].header.Get("Content-Type"))
+	}
+	if reqs[0].header.Get("X-Scope-OrgID") != "" {
+		t.Errorf("X-Scope-OrgID без TenantID: %q", reqs[0].header.Get("X-Scope-OrgID"))
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(reqs[0].body, &push); err != nil {
+		t.Fatalf("тело %s: %v", reqs[0].body, err)
+	}
+	// Без метки level все записи попадают в один поток.
+	if len(push.Streams) != 1 {
+		t.Fatalf("потоков: %d: %s", len(push.Streams), reqs[0].body)
+	}
+	s := push.Streams[0]
+	if len(s.Stream) != 2 || s.Stream["app"] != "app" || s.Stream["version"] != "1.2" {
+		t.Errorf("метки %v", s.Stream)
+	}
+	if len(s.Values) != 2 {
+		t.Fatalf("записей: %d", len(s.Values))
+	}
+	for i, msg := range []string{`"info"`, io.ErrUnexpectedEOF.Error()} {
+		ns, err := strconv.ParseInt(s.Values[i][0], 10, 64)
+		if err != nil {
+			t.Fatalf("время %q: %v", s.Values[i][0], err)
+		}
+		checkLokiTime(t, time.Unix(0, ns), start)
+		if !strings.Contains(s.Values[i][1], msg) {
+			t.Errorf("строка %d: %s", i, s.Values[i][1])
+		}
+	}
+}
+
+func TestLokiRetriesServerErrors(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusInternalServerError)
+	l := newOutputTestLogger(t, OutputConf{Type: OutputLoki, Loki: &LokiConf{URL: srv.URL, Batch: testBatchConf()}})
+	l.Info(context.Background(), "retried")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 4 {
+		t.Fatalf("запросов: %d, ожидалось 4 (3 ошибки и успех)", len(reqs))
+	}
+	for i := 1; i < len(reqs); i++ {
+		if string(reqs[i].body) != string(reqs[0].body) {
+			t.Errorf("повтор %d отправил другое тело", i)
+		}
+	}
+	if stats := Stats(l); len(stats) != 1 || stats[0].Dropped != 0 || stats[0].Entries != 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func TestLokiDoesNotRetryClientErrors(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusBadRequest)
+	l := newOutputTestLogger(t, OutputConf{Type: OutputLoki, Loki: &LokiConf{URL: srv.URL, Batch: testBatchConf()}})
+	l.Info(context.Background(), "rejected")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if reqs := srv.recorded(); len(reqs) != 1 {
+		t.Errorf("запросов: %d, ответ 400 не должен повторяться", len(reqs))
+	}
+	if stats := Stats(l); len(stats) != 1 || stats[0].Dropped != 1 {
+		t.Errorf("Stats = %+v, ожидалась одна отброшенная запись", stats)
+	}
+}
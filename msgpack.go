@@ -0,0 +1,250 @@
+package logit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Минимальный кодировщик MessagePack для протокола Fluent Forward и чтение
+// ответов приемника.
+
+func appendMsgpackNil(dst []byte) []byte {
+	return append(dst, 0xc0)
+}
+
+func appendMsgpackBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+func appendMsgpackInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(dst, uint64(v))
+	case v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(v))
+	}
+}
+
+func appendMsgpackUint(dst []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(dst, byte(v))
+	case v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xcf), v)
+	}
+}
+
+func appendMsgpackFloat(dst []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(v))
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, s...)
+}
+
+func appendMsgpackBinary(dst []byte, b []byte) []byte {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xc5), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xc6), uint32(n))
+	}
+	return append(dst, b...)
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+	}
+}
+
+// appendMsgpackEventTime добавляет EventTime Fluent: fixext8 типа 0 с секундами
+// и наносекундами.
+func appendMsgpackEventTime(dst []byte, t time.Time) []byte {
+	dst = append(dst, 0xd7, 0x00)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond()))
+}
+
+// appendMsgpackJSON перекодирует значение JSON в MessagePack, сохраняя порядок
+// ключей объектов. Целые числа кодируются как целые, остальные - как float64.
+func appendMsgpackJSON(dst []byte, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dst, err := appendMsgpackJSONValue(dst, dec)
+	if err != nil {
+		return nil, fmt.Errorf("перекодирование JSON в msgpack: %w", err)
+	}
+	return dst, nil
+}
+
+func appendMsgpackJSONValue(dst []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		var body []byte
+		n := 0
+		for dec.More() {
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				body = appendMsgpackString(body, key.(string))
+			}
+			if body, err = appendMsgpackJSONValue(body, dec); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		if _, err := dec.Token(); err != nil { // закрывающая скобка
+			return nil, err
+		}
+		if v == '{' {
+			dst = appendMsgpackMapHeader(dst, n)
+		} else {
+			dst = appendMsgpackArrayHeader(dst, n)
+		}
+		return append(dst, body...), nil
+	case string:
+		return appendMsgpackString(dst, v), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendMsgpackInt(dst, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackFloat(dst, f), nil
+	case bool:
+		return appendMsgpackBool(dst, v), nil
+	case nil:
+		return appendMsgpackNil(dst), nil
+	default:
+		return nil, errors.New("неожиданный элемент JSON")
+	}
+}
+
+// maxMsgpackString ограничивает длину читаемой строки, чтобы ответ приемника
+// не приводил к выделению гигантского буфера.
+const maxMsgpackString = 1 << 16
+
+// readMsgpackMapHeader читает заголовок карты (fixmap, map16, map32).
+func readMsgpackMapHeader(r io.Reader) (int, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, err
+	}
+	switch c := b[0]; {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint16(b[:2])), nil
+	case c == 0xdf:
+		if _, err := io.ReadFull(r, b[:4]); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b[:4])), nil
+	default:
+		return 0, fmt.Errorf("ожидалась карта MessagePack, получен тип 0x%x", c)
+	}
+}
+
+// readMsgpackString читает строку в любом строковом формате (fixstr, str8, str16, str32).
+func readMsgpackString(r io.Reader) (string, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return "", err
+	}
+	var n int
+	switch c := b[0]; {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9:
+		if _, err := io.ReadFull(r, b[:1]); err != nil {
+			return "", err
+		}
+		n = int(b[0])
+	case c == 0xda:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(b[:2]))
+	case c == 0xdb:
+		if _, err := io.ReadFull(r, b[:4]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint32(b[:4]))
+	default:
+		return "", fmt.Errorf("ожидалась строка MessagePack, получен тип 0x%x", c)
+	}
+	if n > maxMsgpackString {
+		return "", fmt.Errorf("строка MessagePack длиной %d байт", n)
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
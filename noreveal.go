@@ -0,0 +1,6 @@
+//go:build !logit_reveal
+
+package logit
+
+// revealSecrets выключен: значения Secret и Sensitive не выводятся ни в один вывод.
+const revealSecrets = false
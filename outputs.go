@@ -0,0 +1,344 @@
+package logit
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Типы выводов.
+const (
+	OutputConsole       = "console"
+	OutputFile          = "file"
+	OutputSyslog        = "syslog"
+	OutputJournald      = "journald"
+	OutputLoki          = "loki"
+	OutputElasticsearch = "elasticsearch" // также OpenSearch
+	OutputFluent        = "fluent"        // Fluentd/Fluent Bit, протокол Forward
+	OutputGELF          = "gelf"          // Graylog
+	OutputKafka         = "kafka"
+	OutputWebhook       = "webhook"
+)
+
+// Кодировщики выводов.
+const (
+	EncoderJSON    = "json"
+	EncoderConsole = "console"
+	EncoderPretty  = "pretty" // консольный формат для разработки, см. prettyEncoder
+	EncoderLogfmt  = "logfmt" // key=value через пробел, см. NewLogfmtEncoder
+)
+
+// OutputConf описывает один вывод логов: куда писать, какие уровни и в каком формате.
+// Пример: app.log со всеми уровнями и app-error.log только с Error и выше.
+type OutputConf struct {
+	Type     string         `yaml:"type" json:"type"`         // console, file или удаленный приемник (Output*)
+	Encoder  string         `yaml:"encoder" json:"encoder"`   // json, console, pretty или logfmt; по умолчанию console для консоли и json для файла
+	MinLevel *zapcore.Level `yaml:"minLevel" json:"minLevel"` // nil - без ограничения снизу
+	MaxLevel *zapcore.Level `yaml:"maxLevel" json:"maxLevel"` // nil - без ограничения сверху
+
+	// Profile приводит ключи и форматы значений к схеме ecs или gcp; кодировщик
+	// по умолчанию при этом - json. GCPProject нужен профилю gcp для полного
+	// имени трассировки projects/<id>/traces/<traceId>.
+	Profile    string `yaml:"profile" json:"profile"`
+	GCPProject string `yaml:"gcpProject" json:"gcpProject"`
+
+	// Параметры консольного вывода.
+	Stream string `yaml:"stream" json:"stream"` // stdout (по умолчанию) или stderr
+	Color  string `yaml:"color" json:"color"`   // auto (по умолчанию), always или never
+
+	// Параметры файлового вывода.
+	FileName    string           `yaml:"fileName" json:"fileName"`       // относительно LoggerConf.Dir; по умолчанию appName_appVersion_YYYY-MM-DD.log
+	Rotation    *RotationConf    `yaml:"rotation" json:"rotation"`       // nil - параметры из LoggerConf
+	Compression *CompressionConf `yaml:"compression" json:"compression"` // nil - Params.Compression
+	Sync        *SyncPolicy      `yaml:"sync" json:"sync"`               // nil - Params.FileSync
+	Encryption  *EncryptionConf  `yaml:"encryption" json:"encryption"`   // nil - Params.Encryption или Params.KeyProvider
+
+	// Syslog - параметры вывода в syslog. Кодировщик по умолчанию - logfmt.
+	Syslog *SyslogConf `yaml:"syslog" json:"syslog"`
+	// Journald - параметры вывода в systemd-journald. Кодировщик используется
+	// только для запасного вывода в stdout.
+	Journald *JournaldConf `yaml:"journald" json:"journald"`
+	// Loki - параметры отправки в Grafana Loki. Кодировщик строки по умолчанию - json.
+	Loki *LokiConf `yaml:"loki" json:"loki"`
+	// Elasticsearch - параметры индексации в Elasticsearch/OpenSearch. Кодировщик
+	// документов по умолчанию - json; удобен профиль ecs.
+	Elasticsearch *ElasticsearchConf `yaml:"elasticsearch" json:"elasticsearch"`
+	// Fluent - параметры отправки в Fluentd/Fluent Bit. Допустим только кодировщик json.
+	Fluent *FluentConf `yaml:"fluent" json:"fluent"`
+	// GELF - параметры отправки в Graylog. Формат сообщения задан GELF, поэтому
+	// Encoder и Profile не используются.
+	GELF *GELFConf `yaml:"gelf" json:"gelf"`
+	// Kafka - параметры отправки в Kafka. Кодировщик по умолчанию - json.
+	Kafka *KafkaConf `yaml:"kafka" json:"kafka"`
+	// Webhook - параметры отправки на HTTP-адрес. Допустим только кодировщик json.
+	Webhook *WebhookConf `yaml:"webhook" json:"webhook"`
+
+	// Spool включает дисковую очередь для выводов с пакетной отправкой (Loki,
+	// Elasticsearch, Fluent, GELF, Kafka, webhook, syslog); nil - очередь в памяти.
+	// Для Sentry спул задается в Params.SentrySpool.
+	Spool *SpoolConf `yaml:"spool" json:"spool"`
+}
+
+// RotationConf задает ротацию файлового вывода.
+type RotationConf struct {
+	MaxSize      int    `yaml:"maxSize" json:"maxSize"`           // в мегабайтах
+	MaxBackups   int    `yaml:"maxBackups" json:"maxBackups"`     // количество старых файлов
+	MaxAge       int    `yaml:"maxAge" json:"maxAge"`             // в днях
+	Compress     bool   `yaml:"compress" json:"compress"`         // встроенное gzip-сжатие lumberjack
+	RotationTime string `yaml:"rotationTime" json:"rotationTime"` // например, "24h"; пусто или "0" - без ротации по времени
+}
+
+// outputs возвращает список выводов. Если Params.Outputs не задан, он строится
+// из флагов EnableConsole/EnableFile конфигурации логгера: в локальном окружении
+// консоль получает pretty-формат, в остальных - JSON; файл всегда пишется в JSON.
+func (p *Params) outputs() []OutputConf {
+	if len(p.Outputs) > 0 {
+		return p.Outputs
+	}
+
+	consoleEncoder := EncoderJSON
+	if p.Env.IsLocal() {
+		consoleEncoder = EncoderPretty
+	}
+
+	var outputs []OutputConf
+	if p.LoggerConf.EnableConsole {
+		level := zapcore.Level(p.LoggerConf.ConsoleLevel)
+		outputs = append(outputs, OutputConf{Type: OutputConsole, Encoder: consoleEncoder, MinLevel: &level})
+	}
+	if p.LoggerConf.EnableFile {
+		level := zapcore.Level(p.LoggerConf.FileLevel)
+		outputs = append(outputs, OutputConf{Type: OutputFile, Encoder: EncoderJSON, MinLevel: &level})
+	}
+	return outputs
+}
+
+// newOutputCore создает ядро zap для вывода out.
+func newOutputCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	switch out.Type {
+	case OutputConsole:
+		var stream *os.File
+		switch out.Stream {
+		case "", "stdout":
+			stream = os.Stdout
+		case "stderr":
+			stream = stderr
+		default:
+			return nil, fmt.Errorf("logger: неизвестный поток консольного вывода %q", out.Stream)
+		}
+		encoder, err := out.encoder(EncoderConsole, encoderConfig, useColor(out.Color, stream))
+		if err != nil {
+			return nil, err
+		}
+		return zapcore.NewCore(encoder, zapcore.Lock(stream), out.levelEnabler()), nil
+
+	case OutputFile:
+		encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+		if err != nil {
+			return nil, err
+		}
+		policy := out.Sync
+		if policy == nil {
+			policy = params.FileSync
+		}
+		if policy != nil {
+			if err := policy.validate(); err != nil {
+				return nil, err
+			}
+		}
+		writer, err := newFileWriter(params, out)
+		if err != nil {
+			return nil, err
+		}
+		core := zapcore.NewCore(encoder, writer, out.levelEnabler())
+		if policy != nil {
+			core = newSyncCore(core, writer, *policy, params.errorHandler())
+		}
+		return &fileCore{Core: core, w: writer, onError: params.errorHandler()}, nil
+
+	case OutputSyslog:
+		return newSyslogCore(params, out, encoderConfig)
+
+	case OutputJournald:
+		return newJournaldCore(params, out, encoderConfig)
+
+	case OutputLoki:
+		return newLokiCore(params, out, encoderConfig)
+
+	case OutputElasticsearch:
+		return newElasticsearchCore(params, out, encoderConfig)
+
+	case OutputFluent:
+		return newFluentCore(params, out, encoderConfig)
+	case OutputGELF:
+		return newGELFCore(params, out, encoderConfig)
+	case OutputKafka:
+		return newKafkaCore(params, out, encoderConfig)
+	case OutputWebhook:
+		return newWebhookCore(params, out, encoderConfig)
+
+	default:
+		return nil, fmt.Errorf("logger: неизвестный тип вывода %q", out.Type)
+	}
+}
+
+// fileCore закрывает файл вывода вместе с логгером (см. Close): фоновый воркер
+// дожимает ротированные файлы и вызывает для них обработчики ротации.
+type fileCore struct {
+	zapcore.Core
+	w       *TimeRotatingWriter
+	onError func(error)
+}
+
+func (c *fileCore) close() {
+	if inner, ok := c.Core.(interface{ close() }); ok {
+		inner.close()
+	}
+	if err := c.w.Close(); err != nil {
+		c.onError(fmt.Errorf("logger: закрытие %s: %w", c.w.Logger.Filename, err))
+	}
+}
+
+// encoder создает кодировщик вывода с учетом профиля. fallback - кодировщик
+// по умолчанию для типа вывода, если не заданы ни Encoder, ни Profile.
+func (out OutputConf) encoder(fallback string, encoderConfig zapcore.EncoderConfig, color bool) (zapcore.Encoder, error) {
+	encoderConfig, profile, err := applyProfile(out.Profile, out.GCPProject, encoderConfig)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return newEncoder(out.Encoder, fallback, encoderConfig, color)
+	}
+	encoder, err := newEncoder(out.Encoder, EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	return newProfileEncoder(encoder, profile), nil
+}
+
+// newEncoder создает кодировщик по имени. color включается только для консольных
+// выводов, подключенных к терминалу, чтобы ANSI-коды не попадали в файлы и пайпы.
+func newEncoder(name, fallback string, encoderConfig zapcore.EncoderConfig, color bool) (zapcore.Encoder, error) {
+	if name == "" {
+		name = fallback
+	}
+	switch strings.ToLower(name) {
+	case EncoderJSON:
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case EncoderConsole:
+		if color {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	case EncoderPretty:
+		return newPrettyEncoder(encoderConfig, color), nil
+	case EncoderLogfmt:
+		return NewLogfmtEncoder(encoderConfig), nil
+	default:
+		return nil, fmt.Errorf("logger: неизвестный кодировщик %q", name)
+	}
+}
+
+// levelEnabler пропускает уровни из диапазона [MinLevel, MaxLevel].
+func (out OutputConf) levelEnabler() zapcore.LevelEnabler {
+	minLevel, maxLevel := zapcore.DebugLevel, zapcore.FatalLevel
+	if out.MinLevel != nil {
+		minLevel = *out.MinLevel
+	}
+	if out.MaxLevel != nil {
+		maxLevel = *out.MaxLevel
+	}
+	return levelRange{min: minLevel, max: maxLevel}
+}
+
+type levelRange struct {
+	min, max zapcore.Level
+}
+
+func (r levelRange) Enabled(lvl zapcore.Level) bool {
+	return lvl >= r.min && lvl <= r.max
+}
+
+// rotation возвращает параметры ротации вывода, по умолчанию - из LoggerConf.
+func (p *Params) rotation(out OutputConf) RotationConf {
+	if out.Rotation != nil {
+		return *out.Rotation
+	}
+	return RotationConf{
+		MaxSize:      p.LoggerConf.MaxSize,
+		MaxBackups:   p.LoggerConf.MaxBackups,
+		MaxAge:       p.LoggerConf.MaxAge,
+		Compress:     p.LoggerConf.Compress,
+		RotationTime: p.LoggerConf.RotationTime,
+	}
+}
+
+// newFileWriter создает ротируемый файл для вывода out.
+func newFileWriter(params *Params, out OutputConf) (*TimeRotatingWriter, error) {
+	rotation := params.rotation(out)
+
+	var rotationTime time.Duration
+	if rotation.RotationTime != "" {
+		var err error
+		rotationTime, err = time.ParseDuration(rotation.RotationTime)
+		if err != nil {
+			return nil, fmt.Errorf("Некорректное время ротации (RotationTime): %v. Используйте формат вроде '24h', '5m'.", err)
+		}
+	}
+
+	// Имя файла для lumberjack. Lumberjack будет ротировать этот файл.
+	// Если fileName включает дату, то каждый день будет создаваться новый *базовый* файл,
+	// и lumberjack будет ротировать уже его.
+	// TimeRotatingWriter затем будет принудительно ротировать этот файл по времени.
+	name := out.FileName
+	if name == "" {
+		name = fileName(params.AppConf.Name, params.AppConf.Version)
+	}
+	logFilePath := name
+	if !filepath.IsAbs(name) {
+		logFilePath = filepath.Join(params.LoggerConf.Dir, name)
+	}
+
+	lumberjackLogger := &lumberjack.Logger{
+		Filename:   logFilePath,
+		MaxSize:    rotation.MaxSize, // в мегабайтах
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge, // в днях
+		Compress:   rotation.Compress,
+	}
+
+	var rotatingOpts []RotatingOption
+	compression := out.Compression
+	if compression == nil {
+		compression = params.Compression
+	}
+	if compression != nil {
+		compressor, err := NewCompressor(compression.Algorithm, compression.Level)
+		if err != nil {
+			return nil, err
+		}
+		rotatingOpts = append(rotatingOpts,
+			WithCompressor(compressor),
+			WithPostRotateQueue(compression.QueueSize),
+		)
+	}
+	keys, err := params.keyProvider(out)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		rotatingOpts = append(rotatingOpts, WithEncryption(keys))
+	}
+	for _, hook := range params.RotationHooks {
+		rotatingOpts = append(rotatingOpts, WithRotationHook(hook))
+	}
+	rotatingOpts = append(rotatingOpts, WithErrorHandler(params.errorHandler()))
+
+	// TimeRotatingWriter используется и без ротации по времени (rotationTime == 0):
+	// в отличие от lumberjack.Logger он реализует Sync через fsync.
+	return NewTimeRotatingWriter(lumberjackLogger, rotationTime, rotatingOpts...), nil
+}
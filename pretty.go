@@ -0,0 +1,152 @@
+package logit
+
+import (
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"strings"
+)
+
+// Режимы цветного вывода в консоль.
+const (
+	ColorAuto   = "auto"   // цвет, если поток - терминал и не задана переменная NO_COLOR
+	ColorAlways = "always" // цвет всегда
+	ColorNever  = "never"  // без цвета
+)
+
+// ANSI-последовательности для pretty-кодировщика.
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// shortTraceLen - сколько символов traceId показывает pretty-кодировщик.
+const shortTraceLen = 8
+
+// useColor решает, раскрашивать ли вывод в поток f.
+// Явный ColorAlways сильнее NO_COLOR: переменная отключает цвет только по умолчанию.
+func useColor(mode string, f *os.File) bool {
+	switch strings.ToLower(mode) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// isTerminal сообщает, подключен ли f к терминалу.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// prettyEncoder - консольный кодировщик для разработки: op выводится перед
+// сообщением, traceId - в сокращенном виде после него, а многострочный стектрейс
+// печатается с отступами под записью.
+type prettyEncoder struct {
+	zapcore.Encoder
+	color      bool
+	lineEnding string
+}
+
+// newPrettyEncoder создает pretty-кодировщик на основе консольного кодировщика zap.
+func newPrettyEncoder(encoderConfig zapcore.EncoderConfig, color bool) zapcore.Encoder {
+	lineEnding := encoderConfig.LineEnding
+	if lineEnding == "" {
+		lineEnding = zapcore.DefaultLineEnding
+	}
+	encoderConfig.StacktraceKey = "" // стектрейс печатаем сами
+	if color {
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	return &prettyEncoder{
+		Encoder:    zapcore.NewConsoleEncoder(encoderConfig),
+		color:      color,
+		lineEnding: lineEnding,
+	}
+}
+
+func (e *prettyEncoder) Clone() zapcore.Encoder {
+	return &prettyEncoder{
+		Encoder:    e.Encoder.Clone(),
+		color:      e.color,
+		lineEnding: e.lineEnding,
+	}
+}
+
+func (e *prettyEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	var op, traceID string
+	rest := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		if f.Type == zapcore.StringType {
+			switch f.Key {
+			case string(opKey):
+				op = f.String
+				continue
+			case string(traceIDKey):
+				traceID = f.String
+				continue
+			}
+		}
+		rest = append(rest, f)
+	}
+
+	var msg strings.Builder
+	if op != "" {
+		msg.WriteString(e.paint(ansiCyan, "["+op+"]"))
+		msg.WriteByte(' ')
+	}
+	msg.WriteString(ent.Message)
+	if traceID != "" {
+		if len(traceID) > shortTraceLen {
+			traceID = traceID[:shortTraceLen]
+		}
+		msg.WriteByte(' ')
+		msg.WriteString(e.paint(ansiDim, "#"+traceID))
+	}
+	ent.Message = msg.String()
+
+	buf, err := e.Encoder.EncodeEntry(ent, rest)
+	if err != nil || ent.Stack == "" {
+		return buf, err
+	}
+
+	// Стектрейс zap состоит из пар строк "функция" / "\tфайл:строка";
+	// выводим их одной строкой на кадр с отступом.
+	line := strings.TrimSuffix(buf.String(), e.lineEnding)
+	buf.Reset()
+	buf.AppendString(line)
+	frames := strings.Split(ent.Stack, "\n")
+	for i := 0; i < len(frames); i++ {
+		fn := strings.TrimSpace(frames[i])
+		if fn == "" {
+			continue
+		}
+		buf.AppendString(e.lineEnding)
+		buf.AppendString("    at ")
+		buf.AppendString(fn)
+		if i+1 < len(frames) && strings.HasPrefix(frames[i+1], "\t") {
+			i++
+			buf.AppendByte(' ')
+			buf.AppendString(e.paint(ansiDim, "("+strings.TrimSpace(frames[i])+")"))
+		}
+	}
+	buf.AppendString(e.lineEnding)
+	return buf, nil
+}
+
+// paint оборачивает s в ANSI-код, если цвет включен.
+func (e *prettyEncoder) paint(code, s string) string {
+	if !e.color {
+		return s
+	}
+	return code + s + ansiReset
+}
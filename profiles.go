@@ -0,0 +1,298 @@
+package logit
+
+import (
+	"fmt"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Профили вывода: соглашения об именах ключей и форматах значений.
+const (
+	ProfileECS = "ecs" // Elastic Common Schema
+	ProfileGCP = "gcp" // Google Cloud Logging (structured logging)
+)
+
+// ecsVersion - версия Elastic Common Schema, которой соответствует профиль ecs.
+const ecsVersion = "8.11.0"
+
+// Ключи полей, которые логгер добавляет сам.
+const (
+	appNameKey    = "appName"
+	appVersionKey = "appVersion"
+	errorKey      = "error"
+)
+
+// outputProfile описывает, как профиль переименовывает ключи и меняет значения.
+type outputProfile struct {
+	name    string
+	renames map[string]string
+	// project - идентификатор проекта GCP для формата трассировки
+	// projects/<project>/traces/<traceId>.
+	project string
+}
+
+var ecsRenames = map[string]string{
+	string(traceIDKey): "trace.id",
+	string(opKey):      "labels.op",
+	appNameKey:         "service.name",
+	appVersionKey:      "service.version",
+	errorKey:           "error.message",
+}
+
+const gcpTraceKey = "logging.googleapis.com/trace"
+
+var gcpRenames = map[string]string{
+	string(traceIDKey): gcpTraceKey,
+}
+
+// applyProfile настраивает EncoderConfig под профиль и возвращает описание профиля.
+// Пустое имя означает отсутствие профиля.
+func applyProfile(name, gcpProject string, cfg zapcore.EncoderConfig) (zapcore.EncoderConfig, *outputProfile, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return cfg, nil, nil
+	case ProfileECS:
+		cfg.TimeKey = "@timestamp"
+		cfg.EncodeTime = utcRFC3339NanoEncoder
+		cfg.LevelKey = "log.level"
+		cfg.EncodeLevel = zapcore.LowercaseLevelEncoder
+		cfg.NameKey = "log.logger"
+		cfg.MessageKey = "message"
+		cfg.StacktraceKey = "error.stack_trace"
+		cfg.CallerKey = ""   // выводится как log.origin.*
+		cfg.FunctionKey = "" // выводится как log.origin.function
+		return cfg, &outputProfile{name: ProfileECS, renames: ecsRenames}, nil
+	case ProfileGCP:
+		cfg.TimeKey = "timestamp"
+		cfg.EncodeTime = utcRFC3339NanoEncoder
+		cfg.LevelKey = "severity"
+		cfg.EncodeLevel = gcpSeverityEncoder
+		cfg.MessageKey = "message"
+		cfg.StacktraceKey = "stack_trace" // распознается Error Reporting
+		cfg.CallerKey = ""                // выводится как logging.googleapis.com/sourceLocation
+		cfg.FunctionKey = ""
+		return cfg, &outputProfile{name: ProfileGCP, renames: gcpRenames, project: gcpProject}, nil
+	default:
+		return cfg, nil, fmt.Errorf("logger: неизвестный профиль вывода %q", name)
+	}
+}
+
+func utcRFC3339NanoEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(t.UTC().Format(time.RFC3339Nano))
+}
+
+// gcpSeverityEncoder переводит уровень zap в LogSeverity Cloud Logging.
+func gcpSeverityEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch l {
+	case zapcore.DebugLevel:
+		enc.AppendString("DEBUG")
+	case zapcore.InfoLevel:
+		enc.AppendString("INFO")
+	case zapcore.WarnLevel:
+		enc.AppendString("WARNING")
+	case zapcore.ErrorLevel:
+		enc.AppendString("ERROR")
+	case zapcore.DPanicLevel:
+		enc.AppendString("CRITICAL")
+	case zapcore.PanicLevel:
+		enc.AppendString("ALERT")
+	case zapcore.FatalLevel:
+		enc.AppendString("EMERGENCY")
+	default:
+		enc.AppendString("DEFAULT")
+	}
+}
+
+// profileEncoder переименовывает ключи полей согласно профилю и добавляет
+// служебные поля профиля. Поля из With проходят через методы Add*, поля
+// записи - через EncodeEntry.
+type profileEncoder struct {
+	zapcore.Encoder
+	profile *outputProfile
+
+	// service и version для serviceContext профиля gcp.
+	service, version string
+}
+
+func newProfileEncoder(enc zapcore.Encoder, profile *outputProfile) zapcore.Encoder {
+	if profile.name == ProfileECS {
+		enc.AddString("ecs.version", ecsVersion)
+	}
+	return &profileEncoder{Encoder: enc, profile: profile}
+}
+
+func (e *profileEncoder) Clone() zapcore.Encoder {
+	clone := *e
+	clone.Encoder = e.Encoder.Clone()
+	return &clone
+}
+
+func (e *profileEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	out := make([]zapcore.Field, 0, len(fields)+4)
+	service, version := e.service, e.version
+	for _, f := range fields {
+		if e.profile.name == ProfileGCP && f.Type == zapcore.StringType {
+			switch f.Key {
+			case appNameKey:
+				service = f.String
+				continue
+			case appVersionKey:
+				version = f.String
+				continue
+			}
+		}
+		out = append(out, e.field(f)...)
+	}
+
+	switch e.profile.name {
+	case ProfileECS:
+		if ent.Caller.Defined {
+			out = append(out,
+				zapcore.Field{Key: "log.origin.file.name", Type: zapcore.StringType, String: filepath.Base(ent.Caller.File)},
+				zapcore.Field{Key: "log.origin.file.line", Type: zapcore.Int64Type, Integer: int64(ent.Caller.Line)},
+				zapcore.Field{Key: "log.origin.function", Type: zapcore.StringType, String: ent.Caller.Function},
+			)
+		}
+	case ProfileGCP:
+		if service != "" {
+			out = append(out, zapcore.Field{
+				Key:       "serviceContext",
+				Type:      zapcore.ObjectMarshalerType,
+				Interface: gcpServiceContext{service: service, version: version},
+			})
+		}
+		if ent.Caller.Defined {
+			out = append(out, zapcore.Field{
+				Key:       "logging.googleapis.com/sourceLocation",
+				Type:      zapcore.ObjectMarshalerType,
+				Interface: gcpSourceLocation(ent.Caller),
+			})
+		}
+	}
+	return e.Encoder.EncodeEntry(ent, out)
+}
+
+// field переводит поле в представление профиля.
+func (e *profileEncoder) field(f zapcore.Field) []zapcore.Field {
+	if f.Type == zapcore.ErrorType && f.Key == errorKey && e.profile.name == ProfileECS {
+		err, _ := f.Interface.(error)
+		if err == nil {
+			return nil
+		}
+		return []zapcore.Field{
+			{Key: "error.message", Type: zapcore.StringType, String: err.Error()},
+			{Key: "error.type", Type: zapcore.StringType, String: fmt.Sprintf("%T", err)},
+		}
+	}
+	if f.Type == zapcore.StringType && f.Key == string(traceIDKey) {
+		f.String = e.traceValue(f.String)
+	}
+	f.Key = e.key(f.Key)
+	return []zapcore.Field{f}
+}
+
+func (e *profileEncoder) key(k string) string {
+	if renamed, ok := e.profile.renames[k]; ok {
+		return renamed
+	}
+	return k
+}
+
+// traceValue форматирует traceId: для gcp с известным проектом Cloud Logging
+// ожидает полное имя ресурса трассировки.
+func (e *profileEncoder) traceValue(traceID string) string {
+	if e.profile.name == ProfileGCP && e.profile.project != "" {
+		return "projects/" + e.profile.project + "/traces/" + traceID
+	}
+	return traceID
+}
+
+func (e *profileEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	return e.Encoder.AddArray(e.key(key), arr)
+}
+
+func (e *profileEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	return e.Encoder.AddObject(e.key(key), obj)
+}
+
+func (e *profileEncoder) AddBinary(key string, val []byte) { e.Encoder.AddBinary(e.key(key), val) }
+func (e *profileEncoder) AddByteString(key string, val []byte) {
+	e.Encoder.AddByteString(e.key(key), val)
+}
+func (e *profileEncoder) AddBool(key string, val bool) { e.Encoder.AddBool(e.key(key), val) }
+func (e *profileEncoder) AddComplex128(key string, val complex128) {
+	e.Encoder.AddComplex128(e.key(key), val)
+}
+func (e *profileEncoder) AddComplex64(key string, val complex64) {
+	e.Encoder.AddComplex64(e.key(key), val)
+}
+func (e *profileEncoder) AddDuration(key string, val time.Duration) {
+	e.Encoder.AddDuration(e.key(key), val)
+}
+func (e *profileEncoder) AddFloat64(key string, val float64) { e.Encoder.AddFloat64(e.key(key), val) }
+func (e *profileEncoder) AddFloat32(key string, val float32) { e.Encoder.AddFloat32(e.key(key), val) }
+func (e *profileEncoder) AddInt(key string, val int)         { e.Encoder.AddInt(e.key(key), val) }
+func (e *profileEncoder) AddInt64(key string, val int64)     { e.Encoder.AddInt64(e.key(key), val) }
+func (e *profileEncoder) AddInt32(key string, val int32)     { e.Encoder.AddInt32(e.key(key), val) }
+func (e *profileEncoder) AddInt16(key string, val int16)     { e.Encoder.AddInt16(e.key(key), val) }
+func (e *profileEncoder) AddInt8(key string, val int8)       { e.Encoder.AddInt8(e.key(key), val) }
+func (e *profileEncoder) AddTime(key string, val time.Time)  { e.Encoder.AddTime(e.key(key), val) }
+func (e *profileEncoder) AddUint(key string, val uint)       { e.Encoder.AddUint(e.key(key), val) }
+func (e *profileEncoder) AddUint64(key string, val uint64)   { e.Encoder.AddUint64(e.key(key), val) }
+func (e *profileEncoder) AddUint32(key string, val uint32)   { e.Encoder.AddUint32(e.key(key), val) }
+func (e *profileEncoder) AddUint16(key string, val uint16)   { e.Encoder.AddUint16(e.key(key), val) }
+func (e *profileEncoder) AddUint8(key string, val uint8)     { e.Encoder.AddUint8(e.key(key), val) }
+func (e *profileEncoder) AddUintptr(key string, val uintptr) { e.Encoder.AddUintptr(e.key(key), val) }
+func (e *profileEncoder) OpenNamespace(key string)           { e.Encoder.OpenNamespace(e.key(key)) }
+
+func (e *profileEncoder) AddReflected(key string, val any) error {
+	return e.Encoder.AddReflected(e.key(key), val)
+}
+
+// AddString дополнительно обрабатывает traceId и, для gcp, appName/appVersion,
+// которые попадают в serviceContext.
+func (e *profileEncoder) AddString(key, val string) {
+	if e.profile.name == ProfileGCP {
+		switch key {
+		case appNameKey:
+			e.service = val
+			return
+		case appVersionKey:
+			e.version = val
+			return
+		}
+	}
+	if key == string(traceIDKey) {
+		val = e.traceValue(val)
+	}
+	e.Encoder.AddString(e.key(key), val)
+}
+
+// gcpServiceContext - объект serviceContext для Error Reporting.
+type gcpServiceContext struct {
+	service, version string
+}
+
+func (s gcpServiceContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("service", s.service)
+	if s.version != "" {
+		enc.AddString("version", s.version)
+	}
+	return nil
+}
+
+// gcpSourceLocation - объект sourceLocation; line по спецификации передается строкой.
+type gcpSourceLocation zapcore.EntryCaller
+
+func (c gcpSourceLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", c.File)
+	enc.AddString("line", strconv.Itoa(c.Line))
+	if c.Function != "" {
+		enc.AddString("function", c.Function)
+	}
+	return nil
+}
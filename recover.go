@@ -0,0 +1,151 @@
+package logit
+
+import (
+	"context"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultFlushTimeout - сколько Recover по умолчанию ждет отправки события в Sentry.
+const defaultFlushTimeout = 2 * time.Second
+
+// panicKey - поле-признак записи о панике.
+const panicKey = "panic"
+
+// RecoverOptions задает поведение Recover после записи и отправки паники.
+// По умолчанию (nil) паника подавляется.
+type RecoverOptions struct {
+	// Repanic повторно вызывает панику с исходным значением после обработки.
+	Repanic bool
+	// Handler вызывается после записи и отправки в Sentry, до повторной паники.
+	// Получает исходное значение паники.
+	Handler func(ctx context.Context, recovered any)
+	// FlushTimeout - сколько ждать отправки события в Sentry. По умолчанию 2 секунды.
+	FlushTimeout time.Duration
+}
+
+// Recover перехватывает панику и пишет ее в лог уровнем Error с op и traceId
+// из контекста и стектрейсом места паники, отправляет в Sentry через
+// RecoverWithContext и дожидается отправки. Дальнейшее поведение задает opts.
+// Должен вызываться непосредственно через defer:
+//
+//	defer logit.Recover(ctx, log, nil)
+func Recover(ctx context.Context, l Logger, opts *RecoverOptions) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if opts == nil {
+		opts = &RecoverOptions{}
+	}
+
+	err := newPanicError(ctx, recovered)
+	if li, ok := l.(*logIt); ok {
+		ctx = li.ensureTrace(ctx)
+		li.logPanic(ctx, err)
+	} else {
+		l.Error(ctx, err, zap.Bool(panicKey, true))
+	}
+	reportPanic(ctx, err, opts.FlushTimeout)
+
+	if opts.Handler != nil {
+		opts.Handler(ctx, recovered)
+	}
+	if opts.Repanic {
+		panic(recovered)
+	}
+}
+
+// Go запускает fn в отдельной горутине с Recover: паника записывается в лог,
+// отправляется в Sentry и подавляется. Для другого поведения используйте
+// defer logit.Recover(ctx, log, opts) в собственной горутине.
+func Go(ctx context.Context, l Logger, fn func(ctx context.Context)) {
+	go func() {
+		defer Recover(ctx, l, nil)
+		fn(ctx)
+	}()
+}
+
+// newPanicError создает Error для значения паники со стектрейсом, который
+// начинается с места паники, а не с Recover.
+func newPanicError(ctx context.Context, recovered any) *Error {
+	e := &Error{msg: fmt.Sprintf("panic: %v", recovered)}
+	if cause, ok := recovered.(error); ok {
+		e.msg = "panic"
+		e.cause = cause
+	}
+	if ctx != nil {
+		e.op, _ = ctx.Value(opKey).(string)
+	}
+	pcs := make([]uintptr, maxErrorStack)
+	e.stack = panicStack(pcs[:runtime.Callers(1, pcs)])
+	return e
+}
+
+// panicStack отбрасывает кадры до runtime.gopanic включительно и следующие за
+// ним кадры runtime (sigpanic, panicIndex и т.п.).
+func panicStack(pcs []uintptr) []uintptr {
+	for i, pc := range pcs {
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil || fn.Name() != "runtime.gopanic" {
+			continue
+		}
+		rest := pcs[i+1:]
+		for len(rest) > 1 {
+			fn := runtime.FuncForPC(rest[0] - 1)
+			if fn == nil || !strings.HasPrefix(fn.Name(), "runtime.") {
+				break
+			}
+			rest = rest[1:]
+		}
+		return rest
+	}
+	return pcs
+}
+
+// logPanic пишет запись о панике; место вызова и стектрейс указывают на место паники.
+func (l *logIt) logPanic(ctx context.Context, err *Error) {
+	ce := l.logger.Check(zapcore.ErrorLevel, err.Error())
+	if ce == nil {
+		return
+	}
+	if ce.Caller.Defined && len(err.stack) > 0 {
+		ce.Caller = frameCaller(err.stack[0])
+	}
+	if ce.Stack != "" {
+		ce.Stack = formatStack(err.stack)
+	}
+	fields := append([]zap.Field{zap.Bool(panicKey, true), zap.Error(err)}, errorFields(err)...)
+	ce.Write(l.contextFields(ctx, fields)...)
+}
+
+// reportPanic отправляет панику в Sentry и ждет отправки не дольше timeout.
+func reportPanic(ctx context.Context, err *Error, timeout time.Duration) {
+	hub := sentry.CurrentHub()
+	if ctx != nil && sentry.HasHubOnContext(ctx) {
+		hub = sentry.GetHubFromContext(ctx)
+	}
+	if hub.Client() == nil {
+		return
+	}
+	if timeout <= 0 {
+		timeout = defaultFlushTimeout
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		if ctx != nil {
+			if op, ok := ctx.Value(opKey).(string); ok {
+				scope.SetTag(string(opKey), op)
+			}
+			if traceID, ok := ctx.Value(traceIDKey).(string); ok {
+				scope.SetTag(string(traceIDKey), traceID)
+			}
+		}
+		hub.RecoverWithContext(ctx, err)
+	})
+	hub.Flush(timeout)
+}
@@ -0,0 +1,807 @@
+package logit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"hash"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedactAction - что делать со значением, попавшим под правило.
+type RedactAction string
+
+const (
+	RedactMask RedactAction = "mask" // заменить маской
+	RedactHash RedactAction = "hash" // заменить отпечатком SHA-256 (HMAC при заданном HashKey)
+	RedactDrop RedactAction = "drop" // удалить поле; в сообщении - удалить совпадение
+)
+
+// Встроенные детекторы значений.
+const (
+	DetectorCard  = "card"  // номера карт с проверкой по алгоритму Луна
+	DetectorJWT   = "jwt"   // JSON Web Token
+	DetectorEmail = "email" // адреса электронной почты
+)
+
+// defaultMask - маска по умолчанию.
+const defaultMask = "***"
+
+// RedactRule - правило редактирования. Задается ровно одно из Key, Pattern, Detector.
+type RedactRule struct {
+	// Key - имя поля, точное или шаблон path.Match ("*token*"); без учета регистра.
+	// Под правило попадает значение поля целиком, в том числе во вложенных объектах.
+	Key string `yaml:"key" json:"key"`
+	// Pattern - регулярное выражение для строковых значений и сообщений.
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Detector - встроенный детектор: card, jwt или email.
+	Detector string `yaml:"detector" json:"detector"`
+	// Action - mask (по умолчанию), hash или drop.
+	Action RedactAction `yaml:"action" json:"action"`
+}
+
+// RedactionConf - настройки редактирования персональных данных и секретов.
+// Правила применяются до кодирования ко всем выводам и к событиям Sentry.
+type RedactionConf struct {
+	// Defaults добавляет встроенный набор правил: маскирование полей с паролями,
+	// токенами и секретами, номеров карт и JWT, хеширование email.
+	Defaults bool         `yaml:"defaults" json:"defaults"`
+	Rules    []RedactRule `yaml:"rules" json:"rules"`
+	// Mask заменяет значения при действии mask. По умолчанию "***".
+	Mask string `yaml:"mask" json:"mask"`
+	// HashKey - ключ HMAC для действия hash. Без ключа отпечатки совпадающих значений
+	// можно подобрать перебором (например, для email), поэтому задавать его рекомендуется.
+	HashKey string `yaml:"hashKey" json:"hashKey"`
+	// SkipMessages отключает редактирование текста сообщений.
+	SkipMessages bool `yaml:"skipMessages" json:"skipMessages"`
+}
+
+// defaultRedactRules - встроенный набор правил RedactionConf.Defaults.
+var defaultRedactRules = []RedactRule{
+	{Key: "*password*", Action: RedactMask},
+	{Key: "*passwd*", Action: RedactMask},
+	{Key: "*secret*", Action: RedactMask},
+	{Key: "*token*", Action: RedactMask},
+	{Key: "authorization", Action: RedactMask},
+	{Key: "cookie", Action: RedactMask},
+	{Key: "set-cookie", Action: RedactMask},
+	{Key: "*apikey*", Action: RedactMask},
+	{Key: "*api_key*", Action: RedactMask},
+	{Detector: DetectorCard, Action: RedactMask},
+	{Detector: DetectorJWT, Action: RedactMask},
+	{Detector: DetectorEmail, Action: RedactHash},
+}
+
+var (
+	cardRe  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	jwtRe   = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailRe = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// redactor применяет правила к полям, строкам и событиям Sentry.
+type redactor struct {
+	exact    map[string]RedactAction
+	globs    []keyGlob
+	values   []valueRule
+	mask     string
+	hashKey  []byte
+	messages bool
+}
+
+type keyGlob struct {
+	pattern string
+	action  RedactAction
+}
+
+type valueRule struct {
+	re *regexp.Regexp
+	// hint - подстрока, без которой совпадение невозможно; позволяет не запускать
+	// регулярное выражение для большинства строк.
+	hint   string
+	digits bool // совпадение возможно только при наличии цифр
+	luhn   bool
+	action RedactAction
+}
+
+// newRedactor проверяет конфигурацию и компилирует правила.
+func newRedactor(conf *RedactionConf) (*redactor, error) {
+	r := &redactor{
+		exact:    make(map[string]RedactAction),
+		mask:     conf.Mask,
+		hashKey:  []byte(conf.HashKey),
+		messages: !conf.SkipMessages,
+	}
+	if r.mask == "" {
+		r.mask = defaultMask
+	}
+	rules := conf.Rules
+	if conf.Defaults {
+		rules = append(append([]RedactRule(nil), conf.Rules...), defaultRedactRules...)
+	}
+	for i, rule := range rules {
+		action := rule.Action
+		switch action {
+		case "":
+			action = RedactMask
+		case RedactMask, RedactHash, RedactDrop:
+		default:
+			return nil, fmt.Errorf("logger: правило редактирования %d: неизвестное действие %q", i, rule.Action)
+		}
+		set := 0
+		for _, s := range []string{rule.Key, rule.Pattern, rule.Detector} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("logger: правило редактирования %d: нужно задать ровно одно из key, pattern, detector", i)
+		}
+
+		switch {
+		case rule.Key != "":
+			key := strings.ToLower(rule.Key)
+			if !strings.ContainsAny(key, "*?[") {
+				if _, ok := r.exact[key]; !ok {
+					r.exact[key] = action
+				}
+				continue
+			}
+			if _, err := path.Match(key, ""); err != nil {
+				return nil, fmt.Errorf("logger: правило редактирования %d: некорректный шаблон ключа %q: %w", i, rule.Key, err)
+			}
+			r.globs = append(r.globs, keyGlob{pattern: key, action: action})
+		case rule.Pattern != "":
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("logger: правило редактирования %d: %w", i, err)
+			}
+			r.values = append(r.values, valueRule{re: re, action: action})
+		default:
+			switch strings.ToLower(rule.Detector) {
+			case DetectorCard:
+				r.values = append(r.values, valueRule{re: cardRe, digits: true, luhn: true, action: action})
+			case DetectorJWT:
+				r.values = append(r.values, valueRule{re: jwtRe, hint: "eyJ", action: action})
+			case DetectorEmail:
+				r.values = append(r.values, valueRule{re: emailRe, hint: "@", action: action})
+			default:
+				return nil, fmt.Errorf("logger: правило редактирования %d: неизвестный детектор %q", i, rule.Detector)
+			}
+		}
+	}
+	return r, nil
+}
+
+// keyAction возвращает действие для поля с ключом key, если ключ попадает под правило.
+func (r *redactor) keyAction(key string) (RedactAction, bool) {
+	if len(r.exact) == 0 && len(r.globs) == 0 {
+		return "", false
+	}
+	key = strings.ToLower(key)
+	if action, ok := r.exact[key]; ok {
+		return action, true
+	}
+	for _, g := range r.globs {
+		if ok, _ := path.Match(g.pattern, key); ok {
+			return g.action, true
+		}
+	}
+	return "", false
+}
+
+// redactString применяет правила значений к s. drop сообщает, что значение
+// попало под правило с действием drop.
+func (r *redactor) redactString(s string) (out string, drop bool) {
+	out = s
+	var hasDigits, checkedDigits bool
+	for _, rule := range r.values {
+		if rule.hint != "" && !strings.Contains(out, rule.hint) {
+			continue
+		}
+		if rule.digits {
+			if !checkedDigits {
+				hasDigits = strings.ContainsAny(out, "0123456789")
+				checkedDigits = true
+			}
+			if !hasDigits {
+				continue
+			}
+		}
+		matched := false
+		out = rule.re.ReplaceAllStringFunc(out, func(m string) string {
+			if rule.luhn && !luhnValid(m) {
+				return m
+			}
+			matched = true
+			return r.apply(rule.action, m)
+		})
+		if matched && rule.action == RedactDrop {
+			return "", true
+		}
+	}
+	return out, false
+}
+
+// redactMessage применяет правила значений к тексту сообщения; drop удаляет совпадение.
+func (r *redactor) redactMessage(msg string) string {
+	if !r.messages {
+		return msg
+	}
+	out := msg
+	for _, rule := range r.values {
+		if rule.hint != "" && !strings.Contains(out, rule.hint) {
+			continue
+		}
+		if rule.digits && !strings.ContainsAny(out, "0123456789") {
+			continue
+		}
+		out = rule.re.ReplaceAllStringFunc(out, func(m string) string {
+			if rule.luhn && !luhnValid(m) {
+				return m
+			}
+			return r.apply(rule.action, m)
+		})
+	}
+	return out
+}
+
+// apply возвращает замену значения v по действию; для drop - пустую строку.
+func (r *redactor) apply(action RedactAction, v string) string {
+	switch action {
+	case RedactHash:
+		return r.hash(v)
+	case RedactDrop:
+		return ""
+	default:
+		return r.mask
+	}
+}
+
+// hash возвращает отпечаток значения вида "sha256:<16 hex>".
+func (r *redactor) hash(v string) string {
+	var h hash.Hash
+	if len(r.hashKey) > 0 {
+		h = hmac.New(sha256.New, r.hashKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(v))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// luhnValid проверяет номер карты (с пробелами и дефисами) по алгоритму Луна.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// minCardNumber - наименьшее число из 13 цифр; меньшие целые не проверяются детекторами.
+const minCardNumber = 1_000_000_000_000
+
+// fields применяет правила к набору полей. Исходный срез не изменяется.
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		rf, keep, changed := r.field(f)
+		if !changed && out == nil {
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, i, len(fields))
+			copy(out, fields[:i])
+		}
+		if keep {
+			out = append(out, rf)
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// field применяет правила к одному полю.
+func (r *redactor) field(f zapcore.Field) (_ zapcore.Field, keep, changed bool) {
+	if _, ok := sensitive(f); ok {
+		return f, true, false // заменяется secretCore в каждом выводе
+	}
+	if action, ok := r.keyAction(f.Key); ok {
+		if action == RedactDrop {
+			return f, false, true
+		}
+		return zap.String(f.Key, r.apply(action, fieldString(f))), true, true
+	}
+	if len(r.values) == 0 || f.Key == string(traceIDKey) {
+		// traceId генерируется логгером и проверять его детекторами незачем.
+		return f, true, false
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		return r.stringField(f, f.String)
+	case zapcore.ByteStringType:
+		return r.stringField(f, string(f.Interface.([]byte)))
+	case zapcore.StringerType:
+		return r.stringField(f, fieldString(f))
+	case zapcore.Int64Type:
+		if f.Integer >= minCardNumber || f.Integer <= -minCardNumber {
+			return r.stringField(f, strconv.FormatInt(f.Integer, 10))
+		}
+	case zapcore.Uint64Type:
+		if uint64(f.Integer) >= minCardNumber {
+			return r.stringField(f, strconv.FormatUint(uint64(f.Integer), 10))
+		}
+	case zapcore.ErrorType:
+		err, ok := f.Interface.(error)
+		if !ok || err == nil {
+			return f, true, false
+		}
+		msg := err.Error()
+		red, drop := r.redactString(msg)
+		if drop {
+			return f, false, true
+		}
+		if red != msg {
+			f.Interface = redactedError{msg: red}
+			return f, true, true
+		}
+	case zapcore.ObjectMarshalerType:
+		f.Interface = redactObject{obj: f.Interface.(zapcore.ObjectMarshaler), r: r}
+		return f, true, true
+	case zapcore.ArrayMarshalerType:
+		f.Interface = redactArray{arr: f.Interface.(zapcore.ArrayMarshaler), r: r}
+		return f, true, true
+	case zapcore.ReflectType:
+		if len(r.exact) == 0 && len(r.globs) == 0 && len(r.values) == 0 {
+			return f, true, false // ни одно правило не может совпасть
+		}
+		return zap.Any(f.Key, r.reflected(f.Interface)), true, true
+	}
+	return f, true, false
+}
+
+// stringField заменяет поле строковым, если правила изменили его значение s.
+func (r *redactor) stringField(f zapcore.Field, s string) (zapcore.Field, bool, bool) {
+	red, drop := r.redactString(s)
+	if drop {
+		return f, false, true
+	}
+	if red == s {
+		return f, true, false
+	}
+	return zap.String(f.Key, red), true, true
+}
+
+// reflected применяет правила к значению, которое zap кодирует через рефлексию:
+// значение переводится в JSON-представление и обходится целиком. Вложенные
+// значения Sensitive остаются в представлении как есть и заменяются secretCore.
+func (r *redactor) reflected(v any) any {
+	if rv := reflect.ValueOf(v); containsSensitive(rv, 0) {
+		out, _ := r.value(sensitiveJSON(rv, 0, func(s Sensitive) any { return s }))
+		return out
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return r.mask
+	}
+	generic, err := decodeJSON(data)
+	if err != nil {
+		return r.mask
+	}
+	out, _ := r.value(generic)
+	return out
+}
+
+// decodeJSON разбирает data в JSON-модель. Числа остаются json.Number, чтобы
+// int64 больше 2^53 не округлялись при переводе во float64.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// value обходит значение из map/slice/string (JSON-модель или контекст Sentry).
+func (r *redactor) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case Sensitive:
+		return v, true
+	case string:
+		red, drop := r.redactString(v)
+		return red, !drop
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			if _, ok := item.(Sensitive); ok {
+				out[k] = item
+				continue
+			}
+			if action, ok := r.keyAction(k); ok {
+				if action != RedactDrop {
+					out[k] = r.apply(action, fmt.Sprint(item))
+				}
+				continue
+			}
+			if red, keep := r.value(item); keep {
+				out[k] = red
+			}
+		}
+		return out, true
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, item := range v {
+			if red, keep := r.value(item); keep {
+				out = append(out, red)
+			}
+		}
+		return out, true
+	default:
+		return v, true
+	}
+}
+
+// redactEvent применяет правила к событию Sentry: сообщению, исключениям,
+// тегам, extra и контекстам.
+func (r *redactor) redactEvent(event *sentry.Event) *sentry.Event {
+	if event == nil {
+		return nil
+	}
+	event.Message = r.redactMessage(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = r.redactMessage(event.Exception[i].Value)
+	}
+	for k, v := range event.Tags {
+		if action, ok := r.keyAction(k); ok {
+			if action == RedactDrop {
+				delete(event.Tags, k)
+			} else {
+				event.Tags[k] = r.apply(action, v)
+			}
+			continue
+		}
+		event.Tags[k] = r.redactMessage(v)
+	}
+	if event.Extra != nil {
+		red, _ := r.value(event.Extra)
+		event.Extra = red.(map[string]any)
+	}
+	for name, c := range event.Contexts {
+		red, _ := r.value(map[string]any(c))
+		event.Contexts[name] = red.(map[string]any)
+	}
+	return event
+}
+
+// fieldString возвращает значение поля строкой для маскирования и хеширования.
+func fieldString(f zapcore.Field) (s string) {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String
+	case zapcore.StringerType:
+		defer func() {
+			if recover() != nil {
+				s = "<panic>"
+			}
+		}()
+		return f.Interface.(fmt.Stringer).String()
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
+
+// redactedError - ошибка с отредактированным текстом вместо исходной.
+type redactedError struct {
+	msg string
+}
+
+func (e redactedError) Error() string { return e.msg }
+
+// redactCore применяет правила до кодирования: к полям из With сразу, к полям
+// записи и сообщению - один раз на запись для всех выводов. Уровни выводов
+// проверяются вложенным ядром, как и без редактирования.
+type redactCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func newRedactCore(core zapcore.Core, r *redactor) zapcore.Core {
+	return &redactCore{Core: core, r: r}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	inner := c.Core.Check(ent, nil)
+	if inner == nil {
+		return ce
+	}
+	return ce.AddCore(ent, &redactWriter{Core: c.Core, inner: inner, r: c.r})
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.redactMessage(ent.Message)
+	return c.Core.Write(ent, c.r.fields(fields))
+}
+
+// redactWriter передает отредактированную запись ядрам, выбранным вложенным Check.
+type redactWriter struct {
+	zapcore.Core
+	inner *zapcore.CheckedEntry
+	r     *redactor
+}
+
+// Write возвращает ошибки вложенных ядер, чтобы zap сообщил о них в ErrorOutput
+// логгера, как и без редактирования.
+func (w *redactWriter) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = w.r.redactMessage(ent.Message)
+	var errs writeErrors
+	w.inner.Entry = ent
+	w.inner.ErrorOutput = &errs
+	w.inner.Write(w.r.fields(fields)...)
+	return errs.err()
+}
+
+// writeErrors перехватывает ошибки, которые CheckedEntry.Write пишет в ErrorOutput
+// в виде "<время> write error: <ошибка>".
+type writeErrors struct {
+	msgs []string
+}
+
+func (w *writeErrors) Write(p []byte) (int, error) {
+	w.msgs = append(w.msgs, string(p))
+	return len(p), nil
+}
+
+func (w *writeErrors) Sync() error { return nil }
+
+func (w *writeErrors) err() error {
+	if len(w.msgs) == 0 {
+		return nil
+	}
+	msg := strings.TrimSpace(strings.Join(w.msgs, ""))
+	if _, after, ok := strings.Cut(msg, " write error: "); ok {
+		msg = after
+	}
+	return errors.New(msg)
+}
+
+// redactObject применяет правила к полям вложенного объекта.
+type redactObject struct {
+	obj zapcore.ObjectMarshaler
+	r   *redactor
+}
+
+func (o redactObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.obj.MarshalLogObject(&redactObjectEncoder{ObjectEncoder: enc, r: o.r})
+}
+
+// redactArray применяет правила к элементам вложенного массива.
+type redactArray struct {
+	arr zapcore.ArrayMarshaler
+	r   *redactor
+}
+
+func (a redactArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return a.arr.MarshalLogArray(&redactArrayEncoder{ArrayEncoder: enc, r: a.r})
+}
+
+// redactObjectEncoder проверяет ключ каждого поля и строковые значения.
+type redactObjectEncoder struct {
+	zapcore.ObjectEncoder
+	r *redactor
+}
+
+// keyed обрабатывает поле, ключ которого попал под правило. Возвращает false,
+// если поле нужно записать как есть.
+func (e *redactObjectEncoder) keyed(key string, val any) bool {
+	action, ok := e.r.keyAction(key)
+	if !ok {
+		return false
+	}
+	if action != RedactDrop {
+		e.ObjectEncoder.AddString(key, e.r.apply(action, fmt.Sprint(val)))
+	}
+	return true
+}
+
+func (e *redactObjectEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	if e.keyed(key, "[array]") {
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(key, redactArray{arr: arr, r: e.r})
+}
+
+func (e *redactObjectEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	if e.keyed(key, "[object]") {
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(key, redactObject{obj: obj, r: e.r})
+}
+
+func (e *redactObjectEncoder) AddString(key, val string) {
+	if e.keyed(key, val) {
+		return
+	}
+	if red, drop := e.r.redactString(val); !drop {
+		e.ObjectEncoder.AddString(key, red)
+	}
+}
+
+func (e *redactObjectEncoder) AddByteString(key string, val []byte) {
+	e.AddString(key, string(val))
+}
+
+func (e *redactObjectEncoder) AddReflected(key string, val any) error {
+	if e.keyed(key, val) {
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(key, e.r.reflected(val))
+}
+
+func (e *redactObjectEncoder) AddInt64(key string, val int64) {
+	if e.keyed(key, val) {
+		return
+	}
+	if val >= minCardNumber || val <= -minCardNumber {
+		s := strconv.FormatInt(val, 10)
+		if red, drop := e.r.redactString(s); red != s || drop {
+			if !drop {
+				e.ObjectEncoder.AddString(key, red)
+			}
+			return
+		}
+	}
+	e.ObjectEncoder.AddInt64(key, val)
+}
+
+func (e *redactObjectEncoder) AddBinary(key string, val []byte) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddBinary(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddBool(key string, val bool) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddBool(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddComplex128(key string, val complex128) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddComplex128(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddComplex64(key string, val complex64) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddComplex64(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddDuration(key string, val time.Duration) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddDuration(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddFloat64(key string, val float64) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddFloat64(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddFloat32(key string, val float32) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddFloat32(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddInt(key string, val int) { e.AddInt64(key, int64(val)) }
+func (e *redactObjectEncoder) AddInt32(key string, val int32) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddInt32(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddInt16(key string, val int16) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddInt16(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddInt8(key string, val int8) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddInt8(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddTime(key string, val time.Time) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddTime(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddUint(key string, val uint) { e.AddUint64(key, uint64(val)) }
+func (e *redactObjectEncoder) AddUint64(key string, val uint64) {
+	if e.keyed(key, val) {
+		return
+	}
+	if val >= minCardNumber {
+		s := strconv.FormatUint(val, 10)
+		if red, drop := e.r.redactString(s); red != s || drop {
+			if !drop {
+				e.ObjectEncoder.AddString(key, red)
+			}
+			return
+		}
+	}
+	e.ObjectEncoder.AddUint64(key, val)
+}
+func (e *redactObjectEncoder) AddUint32(key string, val uint32) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddUint32(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddUint16(key string, val uint16) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddUint16(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddUint8(key string, val uint8) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddUint8(key, val)
+	}
+}
+func (e *redactObjectEncoder) AddUintptr(key string, val uintptr) {
+	if !e.keyed(key, val) {
+		e.ObjectEncoder.AddUintptr(key, val)
+	}
+}
+
+// redactArrayEncoder применяет правила значений к строковым и вложенным элементам.
+type redactArrayEncoder struct {
+	zapcore.ArrayEncoder
+	r *redactor
+}
+
+func (e *redactArrayEncoder) AppendString(val string) {
+	if red, drop := e.r.redactString(val); !drop {
+		e.ArrayEncoder.AppendString(red)
+	}
+}
+
+func (e *redactArrayEncoder) AppendByteString(val []byte) { e.AppendString(string(val)) }
+
+func (e *redactArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(redactObject{obj: obj, r: e.r})
+}
+
+func (e *redactArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(redactArray{arr: arr, r: e.r})
+}
+
+func (e *redactArrayEncoder) AppendReflected(val any) error {
+	return e.ArrayEncoder.AppendReflected(e.r.reflected(val))
+}
@@ -0,0 +1,96 @@
+package logit
+
+import (
+	"bytes"
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"strings"
+	"testing"
+)
+
+// failingWriter - вывод, запись в который всегда завершается ошибкой.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func newTestRedactor(t testing.TB) *redactor {
+	t.Helper()
+	r, err := newRedactor(&RedactionConf{Defaults: true})
+	if err != nil {
+		t.Fatalf("newRedactor: %v", err)
+	}
+	return r
+}
+
+func TestRedactCoreReportsWriteErrors(t *testing.T) {
+	var errOut bytes.Buffer
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := newRedactCore(zapcore.NewCore(enc, zapcore.AddSync(failingWriter{}), zapcore.DebugLevel), newTestRedactor(t))
+	logger := zap.New(core, zap.ErrorOutput(zapcore.AddSync(&errOut)))
+
+	logger.Info("msg", zap.String("password", "p"))
+	if got := errOut.String(); !strings.Contains(got, "write error: disk full") || strings.Count(got, "write error") != 1 {
+		t.Errorf("ErrorOutput логгера = %q, ожидалась ошибка вложенного ядра", got)
+	}
+}
+
+func benchmarkLogging(b *testing.B, r *redactor) {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(enc, zapcore.AddSync(io.Discard), zapcore.DebugLevel)
+	if r != nil {
+		core = newRedactCore(core, r)
+	}
+	logger := zap.New(core).With(zap.String("service", "billing"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("payment accepted for user@example.com",
+			zap.String("password", "hunter2"),
+			zap.String("card", "4111 1111 1111 1111"),
+			zap.String("path", "/api/v1/payments"),
+			zap.Int("amount", 1500),
+			zap.Object("user", testUser{ID: 7, Name: "Иван", Tags: []string{"vip"}}),
+		)
+	}
+}
+
+func BenchmarkLoggingWithoutRedaction(b *testing.B) {
+	benchmarkLogging(b, nil)
+}
+
+func BenchmarkLoggingWithRedaction(b *testing.B) {
+	benchmarkLogging(b, newTestRedactor(b))
+}
+
+func TestRedactReflectedKeepsInt64Precision(t *testing.T) {
+	type order struct {
+		ID    int64  `json:"id"`
+		Email string `json:"email"`
+	}
+	var buf bytes.Buffer
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	core := newRedactCore(zapcore.NewCore(enc, zapcore.AddSync(&buf), zapcore.DebugLevel), newTestRedactor(t))
+	zap.New(core).Info("m", zap.Any("order", order{ID: 9007199254740993, Email: "user@example.com"}))
+
+	got := buf.String()
+	if !strings.Contains(got, `"id":9007199254740993`) {
+		t.Errorf("запись = %q, id изменился", got)
+	}
+	if strings.Contains(got, "user@example.com") {
+		t.Errorf("запись = %q, email не замаскирован", got)
+	}
+}
+
+func TestRedactReflectedUnchangedWithoutRules(t *testing.T) {
+	r, err := newRedactor(&RedactionConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := struct{ ID int64 }{ID: 9007199254740993}
+	f, keep, changed := r.field(zap.Any("v", v))
+	if !keep || changed || f.Interface != any(v) {
+		t.Errorf("поле без правил изменено: %+v", f)
+	}
+}
@@ -0,0 +1,182 @@
+package logit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Паузы между попытками подключения к удаленным приемникам по умолчанию.
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// backoff вычисляет паузы между повторными попытками: экспоненциальный рост
+// от min до max со случайным разбросом ±20%, чтобы экземпляры приложения
+// не переподключались одновременно.
+type backoff struct {
+	min, max time.Duration
+	attempt  int
+}
+
+func newBackoff(min, max time.Duration) backoff {
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max < min {
+		max = defaultMaxBackoff
+		if max < min {
+			max = min
+		}
+	}
+	return backoff{min: min, max: max}
+}
+
+// next возвращает паузу перед следующей попыткой.
+func (b *backoff) next() time.Duration {
+	d := b.min
+	for i := 0; i < b.attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	b.attempt++
+	jitter := time.Duration(rand.Int64N(int64(d)/5*2+1)) - d/5
+	return d + jitter
+}
+
+// reset сбрасывает паузу к минимальной после успешной попытки.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// TLSConf задает параметры TLS для подключения к удаленному приемнику.
+// Пустая конфигурация проверяет сертификат сервера по системным корневым сертификатам.
+type TLSConf struct {
+	CAFile             string `yaml:"caFile" json:"caFile"`                         // PEM с корневыми сертификатами
+	CertFile           string `yaml:"certFile" json:"certFile"`                     // клиентский сертификат для mTLS
+	KeyFile            string `yaml:"keyFile" json:"keyFile"`                       // ключ клиентского сертификата
+	ServerName         string `yaml:"serverName" json:"serverName"`                 // по умолчанию - хост из адреса
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify"` // только для отладки
+}
+
+// config создает tls.Config. Для nil возвращается конфигурация по умолчанию.
+func (c *TLSConf) config() (*tls.Config, error) {
+	if c == nil {
+		return &tls.Config{}, nil
+	}
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("logger: чтение CA-сертификатов: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("logger: в %s нет PEM-сертификатов", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("logger: для клиентского сертификата нужны certFile и keyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("logger: загрузка клиентского сертификата: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// httpClient создает HTTP-клиент для удаленного приемника.
+func httpClient(tlsConf *TLSConf, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := tlsConf.config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// closeIdle возвращает функцию закрытия простаивающих соединений клиента.
+func closeIdle(client *http.Client) func() error {
+	return func() error {
+		client.CloseIdleConnections()
+		return nil
+	}
+}
+
+// maxErrorBody - часть тела ответа с ошибкой, включаемая в текст ошибки.
+const maxErrorBody = 512
+
+// httpError - ответ удаленного приемника с кодом ошибки.
+type httpError struct {
+	status     int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("HTTP %d", e.status)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+func (e *httpError) retryDelay() time.Duration { return e.retryAfter }
+
+// postHTTP отправляет тело body и проверяет код ответа. Ответы 4xx, кроме 408
+// и 429, возвращаются как permanentError: повтор того же запроса не поможет.
+// При успехе возвращается тело ответа.
+func postHTTP(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return respBody, nil
+	}
+
+	if len(respBody) > maxErrorBody {
+		respBody = respBody[:maxErrorBody]
+	}
+	httpErr := &httpError{status: resp.StatusCode, body: strings.TrimSpace(string(respBody))}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		httpErr.retryAfter = time.Duration(seconds) * time.Second
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return nil, httpErr
+	case resp.StatusCode/100 == 4:
+		return nil, &permanentError{httpErr}
+	default:
+		return nil, httpErr
+	}
+}
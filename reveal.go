@@ -0,0 +1,7 @@
+//go:build logit_reveal
+
+package logit
+
+// revealSecrets включает показ значений Secret и Sensitive в консольном выводе
+// локального окружения. Только для отладочных сборок: go build -tags logit_reveal.
+const revealSecrets = true
@@ -3,10 +3,14 @@ package logit
 import (
 	"fmt"
 	"gopkg.in/natefinch/lumberjack.v2"
+	"os"
 	"sync"
 	"time"
 )
 
+// defaultPostRotateQueue - размер очереди фонового воркера по умолчанию.
+const defaultPostRotateQueue = 16
+
 // TimeRotatingWriter обеспечивает запись с ротацией логов по времени,
 // используя lumberjack.Logger для ротации по размеру/возрасту/количеству.
 type TimeRotatingWriter struct {
@@ -14,18 +18,104 @@ type TimeRotatingWriter struct {
 	rotationTime       time.Duration
 	lastRotation       time.Time
 	mu                 sync.Mutex
+
+	// size и opened повторяют учет lumberjack, чтобы заметить ротацию по размеру,
+	// которую lumberjack выполняет внутри Write без уведомлений.
+	size     int64
+	opened   bool
+	openedAt time.Time // момент открытия текущего файла
+
+	// syncFile - отдельный дескриптор текущего файла для fsync: lumberjack не
+	// предоставляет доступ к своему *os.File. Сбрасывается при ротации.
+	syncFile *os.File
+
+	compressor Compressor
+	hooks      []RotationHook
+	queueSize  int
+	onError    func(error)
+	worker     *postRotateWorker // nil, если ротированные файлы не нужно обрабатывать
+
+	// encryptor шифрует записи; headerWritten - заголовок шифрования уже записан
+	// в текущий файл этим процессом.
+	encryptor     *fileEncryptor
+	headerWritten bool
+}
+
+// RotatingOption настраивает TimeRotatingWriter.
+type RotatingOption func(*TimeRotatingWriter)
+
+// WithCompressor включает сжатие ротированных файлов в фоновом воркере.
+// Встроенное сжатие lumberjack при этом отключается.
+func WithCompressor(c Compressor) RotatingOption {
+	return func(w *TimeRotatingWriter) {
+		w.compressor = c
+	}
+}
+
+// WithPostRotateQueue задает размер очереди фонового воркера. Если очередь
+// переполнена, файл остается необработанным, а ошибка передается в обработчик.
+func WithPostRotateQueue(size int) RotatingOption {
+	return func(w *TimeRotatingWriter) {
+		w.queueSize = size
+	}
+}
+
+// WithErrorHandler задает обработчик ошибок фоновой обработки ротированных файлов.
+// По умолчанию ошибки пишутся в os.Stderr.
+func WithErrorHandler(fn func(error)) RotatingOption {
+	return func(w *TimeRotatingWriter) {
+		w.onError = fn
+	}
+}
+
+// WithRotationHook добавляет обработчик, который вызывается в фоновом воркере
+// для каждого ротированного файла после его закрытия и сжатия.
+// Ошибки обработчика передаются в обработчик ошибок.
+func WithRotationHook(hook RotationHook) RotatingOption {
+	return func(w *TimeRotatingWriter) {
+		w.hooks = append(w.hooks, hook)
+	}
+}
+
+// WithRotationChannel публикует события ротации в канал ch.
+// Отправка выполняется в фоновом воркере и блокирует его, пока событие не будет прочитано.
+func WithRotationChannel(ch chan<- RotatedFile) RotatingOption {
+	return WithRotationHook(func(f RotatedFile) error {
+		ch <- f
+		return nil
+	})
 }
 
 // NewTimeRotatingWriter создает новый TimeRotatingWriter.
 // logger - это экземпляр lumberjack.Logger.
 // rotationTime - длительность, после которой будет произведена принудительная ротация,
 // например, 24*time.Hour. Если rotationTime <= 0, ротация по времени не будет активна.
-func NewTimeRotatingWriter(logger *lumberjack.Logger, rotationTime time.Duration) *TimeRotatingWriter {
-	return &TimeRotatingWriter{
+func NewTimeRotatingWriter(logger *lumberjack.Logger, rotationTime time.Duration, opts ...RotatingOption) *TimeRotatingWriter {
+	w := &TimeRotatingWriter{
 		Logger:       logger,
 		rotationTime: rotationTime,
 		lastRotation: time.Now(), // Устанавливаем время последней ротации на текущее
+		openedAt:     time.Now(),
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
+	if w.onError == nil {
+		w.onError = stderrErrorHandler
+	}
+	if w.compressor == nil && len(w.hooks) > 0 && w.Logger.Compress {
+		// Сжатие lumberjack выполняется асинхронно и не сообщает о завершении:
+		// обработчик получил бы несжатый или уже удаленный файл. Сжимаем сами,
+		// чтобы обработчики вызывались после сжатия.
+		w.compressor = GzipCompressor{}
+	}
+	if w.compressor != nil {
+		w.Logger.Compress = false
+	}
+	if w.compressor != nil || len(w.hooks) > 0 {
+		w.startWorker()
+	}
+	return w
 }
 
 // Write реализует интерфейс io.Writer.
@@ -37,6 +127,8 @@ func (w *TimeRotatingWriter) Write(p []byte) (n int, err error) {
 	// Проверяем, нужно ли ротировать файл по времени
 	// Это условие должно быть истинным, только если rotationTime > 0
 	if w.rotationTime > 0 && time.Since(w.lastRotation) >= w.rotationTime {
+		w.syncBeforeRotate()
+		rotatedAt := time.Now()
 		// Выполняем ротацию через встроенный lumberjack.Logger
 		// lumberjack.Rotate() сам обрабатывает переименование и т.д.
 		if err := w.Logger.Rotate(); err != nil {
@@ -44,32 +136,321 @@ func (w *TimeRotatingWriter) Write(p []byte) (n int, err error) {
 			// но возвращаем ошибку ротации.
 			// Или можно вернуть 0, err немедленно.
 			// Запись в старый файл может быть предпочтительнее потери логов.
-			currentN, writeErr := w.Logger.Write(p)
+			data, _, encErr := w.encode(p)
+			if encErr != nil {
+				return 0, fmt.Errorf("%v (ошибка ротации: %v)", encErr, err)
+			}
+			currentN, writeErr := w.Logger.Write(data)
+			w.size += int64(currentN)
 			if writeErr != nil {
 				return 0, fmt.Errorf("ошибка записи после ошибки ротации: %v (ошибка ротации: %v)", writeErr, err)
 			}
+			currentN, _ = w.written(p, currentN, nil)
 			return currentN, fmt.Errorf("ошибка ротации лог-файла: %v", err)
 		}
 		w.lastRotation = time.Now() // Обновляем время последней ротации
+		w.opened = true
+		w.size = 0
+		w.rotated(rotatedAt, w.lastRotation)
+	}
+
+	// Lumberjack ротирует файл внутри Write, если запись не помещается в MaxSize.
+	// Повторяем его условие, чтобы узнать о ротации.
+	rotatedAt := time.Now()
+	data, sizeRotation, err := w.encode(p)
+	if err != nil {
+		return 0, err
+	}
+	if sizeRotation {
+		w.syncBeforeRotate()
 	}
 
 	// Записываем данные через встроенный lumberjack.Logger
-	return w.Logger.Write(p)
+	n, err = w.Logger.Write(data)
+	if sizeRotation && n > 0 {
+		w.size = 0
+		w.rotated(rotatedAt, time.Now())
+	}
+	w.size += int64(n)
+	return w.written(p, n, err)
+}
+
+// encode возвращает данные для записи p в текущий файл и сообщает, выполнит ли
+// lumberjack при их записи ротацию по размеру. При шифровании p заменяется
+// зашифрованным кадром, а в начало каждого нового файла добавляется заголовок.
+func (w *TimeRotatingWriter) encode(p []byte) ([]byte, bool, error) {
+	if w.encryptor == nil {
+		return p, w.willRotate(int64(len(p))), nil
+	}
+	if !w.headerWritten {
+		if err := w.encryptor.refresh(); err != nil {
+			return nil, false, err
+		}
+	}
+	data, err := w.encryptor.seal(p, !w.headerWritten)
+	if err != nil {
+		return nil, false, err
+	}
+	sizeRotation := w.willRotate(int64(len(data)))
+	if sizeRotation && w.headerWritten {
+		// Кадр попадет в новый файл: ему нужен заголовок текущего ключа.
+		data = append(append(make([]byte, 0, len(w.encryptor.header)+len(data)), w.encryptor.header...), data...)
+	}
+	return data, sizeRotation, nil
+}
+
+// written переводит число записанных в файл байт в результат Write для p:
+// при шифровании в файл пишется больше байт, чем передано.
+func (w *TimeRotatingWriter) written(p []byte, n int, err error) (int, error) {
+	if w.encryptor == nil {
+		return n, err
+	}
+	if n > 0 {
+		w.headerWritten = true
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-// Sync реализует zapcore.WriteSyncer, если это необходимо (хотя zapcore.AddSync обычно используется).
-// Для lumberjack.Logger Sync не определен, но он реализует io.WriteCloser.
-// Если вам нужен Sync, его можно добавить так, или убедиться, что zapcore.AddSync используется правильно.
-// func (w *TimeRotatingWriter) Sync() error {
-//	 // lumberjack.Logger не имеет метода Sync().
-//	 // Если нижележащий файл является os.File, можно было бы вызвать его Sync().
-//	 // В данном случае, можно либо ничего не делать, либо вернуть nil.
-//	 return nil
-// }
+// willRotate сообщает, выполнит ли lumberjack ротацию при записи writeLen байт.
+func (w *TimeRotatingWriter) willRotate(writeLen int64) bool {
+	maxSize := int64(w.Logger.MaxSize) * 1024 * 1024
+	if maxSize == 0 {
+		maxSize = 100 * 1024 * 1024 // значение по умолчанию lumberjack
+	}
+	if !w.opened {
+		w.opened = true
+		w.openedAt = time.Now()
+		info, err := os.Stat(w.Logger.Filename)
+		if err != nil {
+			w.size = 0
+			return false
+		}
+		w.size = info.Size()
+		return w.size+writeLen >= maxSize
+	}
+	return w.size+writeLen > maxSize
+}
+
+// rotated передает ротированный файл фоновому воркеру.
+// since - момент непосредственно перед ротацией; по нему среди бэкапов
+// находится только что созданный. reopenedAt - момент открытия нового файла.
+func (w *TimeRotatingWriter) rotated(since, reopenedAt time.Time) {
+	openedAt := w.openedAt
+	w.openedAt = reopenedAt
+	w.headerWritten = false
+	w.closeSyncFile()
+	if w.worker == nil {
+		return
+	}
+	backups, err := listBackups(w.Logger.Filename, "", w.Logger.LocalTime)
+	if err != nil {
+		w.onError(fmt.Errorf("logger: не удалось найти ротированный файл: %w", err))
+		return
+	}
+	threshold := since.Truncate(time.Millisecond) // точность метки в имени бэкапа
+	for _, b := range backups {
+		if !b.timestamp.Before(threshold) {
+			w.worker.enqueue(rotationTask{path: b.path, openedAt: openedAt, closedAt: since, notify: true})
+		}
+	}
+}
+
+// Sync реализует zapcore.WriteSyncer: сбрасывает текущий файл на диск (fsync).
+// lumberjack.Logger не дает доступа к своему файлу, поэтому fsync выполняется
+// через отдельный дескриптор того же файла - он сбрасывает те же страницы.
+func (w *TimeRotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sync()
+}
+
+// sync выполняет fsync текущего файла. Вызывается под w.mu.
+func (w *TimeRotatingWriter) sync() error {
+	if !w.opened {
+		return nil // ничего не записано, сбрасывать нечего
+	}
+	if w.syncFile == nil {
+		f, err := os.OpenFile(w.Logger.Filename, os.O_WRONLY, 0)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("logger: не удалось открыть файл для fsync: %w", err)
+		}
+		w.syncFile = f
+	}
+	return w.syncFile.Sync()
+}
+
+// syncBeforeRotate сбрасывает на диск файл, который сейчас будет закрыт ротацией.
+// Выполняется только если Sync уже использовался, иначе политика fsync не задана.
+func (w *TimeRotatingWriter) syncBeforeRotate() {
+	if w.syncFile == nil {
+		return
+	}
+	if err := w.syncFile.Sync(); err != nil {
+		w.onError(fmt.Errorf("logger: fsync перед ротацией: %w", err))
+	}
+}
+
+// closeSyncFile закрывает дескриптор для fsync: после ротации он указывает на бэкап.
+func (w *TimeRotatingWriter) closeSyncFile() {
+	if w.syncFile != nil {
+		_ = w.syncFile.Close()
+		w.syncFile = nil
+	}
+}
 
 // Close закрывает логгер. Реализует io.Closer.
+// Дожидается обработки уже ротированных файлов фоновым воркером.
 func (w *TimeRotatingWriter) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.Logger.Close()
+	syncErr := w.sync()
+	w.closeSyncFile()
+	err := w.Logger.Close()
+	if err == nil {
+		err = syncErr
+	}
+	w.opened = false
+	w.headerWritten = false
+	if w.worker != nil {
+		w.worker.stop()
+		w.worker = nil
+	}
+	return err
+}
+
+// startWorker запускает фоновый воркер и ставит в очередь на сжатие несжатые
+// бэкапы, оставшиеся от предыдущего запуска. Обработчики ротации для них
+// не вызываются: время жизни таких файлов неизвестно.
+func (w *TimeRotatingWriter) startWorker() {
+	queueSize := w.queueSize
+	if queueSize <= 0 {
+		queueSize = defaultPostRotateQueue
+	}
+	w.worker = newPostRotateWorker(queueSize, w.processRotated, w.onError)
+
+	if w.compressor == nil {
+		return
+	}
+	backups, err := listBackups(w.Logger.Filename, "", w.Logger.LocalTime)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.onError(fmt.Errorf("logger: не удалось прочитать каталог логов: %w", err))
+		}
+		return
+	}
+	for _, b := range backups {
+		w.worker.enqueue(rotationTask{path: b.path})
+	}
+}
+
+// processRotated выполняется в фоновом воркере для каждого ротированного файла.
+func (w *TimeRotatingWriter) processRotated(task rotationTask) error {
+	path := task.path
+	if w.compressor != nil {
+		compressed, err := compressFile(w.compressor, path)
+		if err != nil {
+			return fmt.Errorf("logger: не удалось сжать %s: %w", path, err)
+		}
+		path = compressed
+		if err := pruneBackups(w.Logger.Filename, w.compressor.Ext(), w.Logger.LocalTime, w.Logger.MaxBackups, w.Logger.MaxAge); err != nil {
+			w.onError(fmt.Errorf("logger: не удалось удалить старые бэкапы: %w", err))
+		}
+	}
+	if !task.notify || len(w.hooks) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("logger: ротированный файл недоступен: %w", err)
+	}
+	event := RotatedFile{
+		Path:     path,
+		Size:     info.Size(),
+		OpenedAt: task.openedAt,
+		ClosedAt: task.closedAt,
+	}
+	for _, hook := range w.hooks {
+		if err := hook(event); err != nil {
+			w.onError(fmt.Errorf("logger: ошибка обработчика ротации для %s: %w", path, err))
+		}
+	}
+	return nil
+}
+
+// rotationTask - ротированный файл в очереди фонового воркера.
+type rotationTask struct {
+	path     string
+	openedAt time.Time
+	closedAt time.Time
+	notify   bool // вызывать ли обработчики ротации
+}
+
+// postRotateWorker последовательно обрабатывает ротированные файлы
+// в отдельной горутине с ограниченной очередью.
+type postRotateWorker struct {
+	queue   chan rotationTask
+	process func(rotationTask) error
+	onError func(error)
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPostRotateWorker(queueSize int, process func(rotationTask) error, onError func(error)) *postRotateWorker {
+	pw := &postRotateWorker{
+		queue:   make(chan rotationTask, queueSize),
+		process: process,
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+	go pw.run()
+	return pw
+}
+
+func (pw *postRotateWorker) run() {
+	defer close(pw.done)
+	for task := range pw.queue {
+		if err := pw.process(task); err != nil {
+			pw.onError(err)
+		}
+	}
+}
+
+// enqueue никогда не блокирует запись логов: при переполненной очереди
+// файл пропускается с сообщением об ошибке.
+func (pw *postRotateWorker) enqueue(task rotationTask) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.closed {
+		return
+	}
+	select {
+	case pw.queue <- task:
+	default:
+		pw.onError(fmt.Errorf("logger: очередь обработки ротированных файлов переполнена, %s пропущен", task.path))
+	}
+}
+
+// stop закрывает очередь и дожидается обработки оставшихся файлов.
+func (pw *postRotateWorker) stop() {
+	pw.mu.Lock()
+	if !pw.closed {
+		pw.closed = true
+		close(pw.queue)
+	}
+	pw.mu.Unlock()
+	<-pw.done
+}
+
+// stderrErrorHandler - обработчик внутренних ошибок логгера по умолчанию.
+func stderrErrorHandler(err error) {
+	fmt.Fprintf(stderr, "Ошибка логгера: %v\n", err)
 }
@@ -0,0 +1,56 @@
+package logit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseWaitsForRotatedFiles(t *testing.T) {
+	var mu sync.Mutex
+	var rotated []string
+	params := newOutputTestParams(t, OutputConf{
+		Type:        OutputFile,
+		Rotation:    &RotationConf{RotationTime: "1ns"}, // ротация перед каждой записью
+		Compression: &CompressionConf{Algorithm: CompressionGzip},
+	})
+	params.RotationHooks = []RotationHook{func(f RotatedFile) error {
+		time.Sleep(50 * time.Millisecond) // медленная выгрузка
+		mu.Lock()
+		defer mu.Unlock()
+		rotated = append(rotated, f.Path)
+		return nil
+	}}
+	l := MustNewLogger(params)
+	for i := 0; i < 3; i++ {
+		l.Info(context.Background(), "message")
+		time.Sleep(5 * time.Millisecond) // имена бэкапов различаются по миллисекундам
+	}
+	if err := Close(l); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rotated) < 2 {
+		t.Fatalf("обработчик вызван для %d файлов, ожидалось не меньше 2", len(rotated))
+	}
+	for _, path := range rotated {
+		if !strings.HasSuffix(path, ".gz") {
+			t.Errorf("обработчик получил несжатый файл %s", path)
+		}
+	}
+	files, err := os.ReadDir(params.LoggerConf.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".tmp" {
+			t.Errorf("после Close остался временный файл %s", f.Name())
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package logit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"reflect"
+	"strings"
+)
+
+// Режимы вывода чувствительных значений.
+const (
+	SecretPlaceholder = "placeholder" // заглушка secretPlaceholder
+	SecretFingerprint = "fingerprint" // отпечаток HMAC-SHA256 по ключу SecretConf.Key
+)
+
+// secretPlaceholder выводится вместо чувствительного значения.
+const secretPlaceholder = "[secret]"
+
+// Sensitive реализуют типы, значения которых никогда не выводятся в лог.
+// Поле с таким значением (zap.Any, zap.Stringer, zap.Object и т.п.) выводится
+// заглушкой или отпечатком во всех выводах и в Sentry. Значения Sensitive внутри
+// структур, map, срезов и указателей, переданных через zap.Any или zap.Reflect,
+// тоже заменяются: такое поле кодируется как JSON-объект с ключами по тегам json
+// (в алфавитном порядке), собственный MarshalJSON содержащих типов не вызывается.
+// Внутри zap.Object значения Sensitive не ищутся - MarshalLogObject должен
+// выводить их через Secret или не выводить вовсе.
+type Sensitive interface {
+	// SensitiveValue возвращает исходное значение. Используется только для расчета
+	// отпечатка и для показа в локальной консоли сборки с тегом logit_reveal.
+	SensitiveValue() string
+}
+
+// SecretConf задает, как выводятся значения Secret и Sensitive.
+type SecretConf struct {
+	// Mode - placeholder (по умолчанию) или fingerprint.
+	Mode string `yaml:"mode" json:"mode"`
+	// Key - ключ HMAC для режима fingerprint. Отпечатки позволяют сравнивать
+	// значения между записями, не раскрывая их.
+	Key string `yaml:"key" json:"key"`
+}
+
+// Secret создает поле, значение которого никогда не выводится в лог.
+func Secret(key string, v any) zap.Field {
+	return zap.Field{Key: key, Type: zapcore.StringerType, Interface: secret{v: v}}
+}
+
+// secret - значение поля Secret. String возвращает заглушку, поэтому значение
+// не раскрывается, даже если поле минует ядро логгера.
+type secret struct {
+	v any
+}
+
+func (s secret) String() string { return secretPlaceholder }
+
+func (s secret) SensitiveValue() string { return fmt.Sprint(s.v) }
+
+// secretRenderer заменяет чувствительные поля заглушкой или отпечатком.
+type secretRenderer struct {
+	key []byte // nil - режим placeholder
+}
+
+// newSecretRenderer проверяет конфигурацию. Для nil возвращает рендерер заглушек.
+func newSecretRenderer(conf *SecretConf) (*secretRenderer, error) {
+	if conf == nil {
+		return &secretRenderer{}, nil
+	}
+	switch conf.Mode {
+	case "", SecretPlaceholder:
+		return &secretRenderer{}, nil
+	case SecretFingerprint:
+		if conf.Key == "" {
+			return nil, fmt.Errorf("logger: для режима %q нужен ключ секретов (key)", SecretFingerprint)
+		}
+		return &secretRenderer{key: []byte(conf.Key)}, nil
+	default:
+		return nil, fmt.Errorf("logger: неизвестный режим вывода секретов %q", conf.Mode)
+	}
+}
+
+// render возвращает представление чувствительного значения.
+func (r *secretRenderer) render(s Sensitive) string {
+	if r == nil || r.key == nil {
+		return secretPlaceholder
+	}
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(s.SensitiveValue()))
+	return "hmac:" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// sensitive возвращает значение поля, если оно чувствительное.
+func sensitive(f zapcore.Field) (Sensitive, bool) {
+	switch f.Type {
+	case zapcore.StringerType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType,
+		zapcore.ReflectType, zapcore.ErrorType:
+		s, ok := f.Interface.(Sensitive)
+		return s, ok
+	}
+	return nil, false
+}
+
+// fields заменяет чувствительные поля. При reveal выводятся исходные значения.
+// Исходный срез не изменяется.
+func (r *secretRenderer) fields(fields []zapcore.Field, reveal bool) []zapcore.Field {
+	leaf := func(s Sensitive) any {
+		if reveal {
+			return s.SensitiveValue()
+		}
+		return r.render(s)
+	}
+	var out []zapcore.Field
+	for i, f := range fields {
+		var rf zapcore.Field
+		if s, ok := sensitive(f); ok {
+			rf = zap.String(f.Key, leaf(s).(string))
+		} else if f.Type == zapcore.ReflectType && containsSensitive(reflect.ValueOf(f.Interface), 0) {
+			rf = zap.Reflect(f.Key, sensitiveJSON(reflect.ValueOf(f.Interface), 0, leaf))
+		} else {
+			if out != nil {
+				out = append(out, f)
+			}
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, i, len(fields))
+			copy(out, fields[:i])
+		}
+		out = append(out, rf)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// maxSensitiveDepth ограничивает глубину обхода значений zap.Any и zap.Reflect
+// (в том числе циклических).
+const maxSensitiveDepth = 32
+
+var sensitiveType = reflect.TypeOf((*Sensitive)(nil)).Elem()
+
+// asSensitive возвращает v как Sensitive, в том числе если метод объявлен
+// у указателя на тип v.
+func asSensitive(v reflect.Value) (Sensitive, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, false
+	}
+	if v.Type().Implements(sensitiveType) {
+		s, ok := v.Interface().(Sensitive)
+		return s, ok
+	}
+	if v.Kind() != reflect.Pointer && reflect.PointerTo(v.Type()).Implements(sensitiveType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		s, ok := p.Interface().(Sensitive)
+		return s, ok
+	}
+	return nil, false
+}
+
+// containsSensitive сообщает, есть ли в v или во вложенных в него значениях,
+// которые кодирует encoding/json, значение Sensitive.
+func containsSensitive(v reflect.Value, depth int) bool {
+	if !v.IsValid() || depth > maxSensitiveDepth {
+		return false
+	}
+	if _, ok := asSensitive(v); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil() && containsSensitive(v.Elem(), depth+1)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if sf := t.Field(i); (sf.IsExported() || sf.Anonymous) && containsSensitive(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if containsSensitive(iter.Value(), depth+1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if containsSensitive(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sensitiveJSON переводит v в JSON-модель (map[string]any, []any, значения),
+// заменяя значения Sensitive результатом leaf. Части v без Sensitive кодируются
+// через encoding/json как есть.
+func sensitiveJSON(v reflect.Value, depth int, leaf func(Sensitive) any) any {
+	if s, ok := asSensitive(v); ok {
+		return leaf(s)
+	}
+	if !containsSensitive(v, depth) {
+		if !v.IsValid() || !v.CanInterface() {
+			return nil
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return v.Interface()
+		}
+		generic, err := decodeJSON(data)
+		if err != nil {
+			return v.Interface()
+		}
+		return generic
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return sensitiveJSON(v.Elem(), depth+1, leaf)
+	case reflect.Struct:
+		out := make(map[string]any)
+		sensitiveStruct(v, depth, leaf, out)
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = sensitiveJSON(iter.Value(), depth+1, leaf)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = sensitiveJSON(v.Index(i), depth+1, leaf)
+		}
+		return out
+	}
+	return nil
+}
+
+// sensitiveStruct добавляет в out поля структуры v по правилам encoding/json:
+// имя из тега json, "-" и omitempty, поля встроенных структур без тега.
+func sensitiveStruct(v reflect.Value, depth int, leaf func(Sensitive) any, out map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			embedded := fv
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if _, ok := asSensitive(fv); !ok {
+					sensitiveStruct(embedded, depth+1, leaf, out)
+					continue
+				}
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && emptyJSONValue(fv) {
+			continue
+		}
+		out[name] = sensitiveJSON(fv, depth+1, leaf)
+	}
+}
+
+// emptyJSONValue повторяет проверку omitempty в encoding/json.
+func emptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// secretCore заменяет чувствительные поля перед кодированием в своем выводе.
+type secretCore struct {
+	zapcore.Core
+	r      *secretRenderer
+	reveal bool
+}
+
+// newSecretCore оборачивает ядро вывода. reveal включается только для
+// консольного вывода в локальном окружении в сборке с тегом logit_reveal.
+func newSecretCore(core zapcore.Core, r *secretRenderer, reveal bool) zapcore.Core {
+	return &secretCore{Core: core, r: r, reveal: reveal}
+}
+
+func (c *secretCore) With(fields []zapcore.Field) zapcore.Core {
+	return &secretCore{Core: c.Core.With(c.r.fields(fields, c.reveal)), r: c.r, reveal: c.reveal}
+}
+
+func (c *secretCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *secretCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.r.fields(fields, c.reveal))
+}
@@ -0,0 +1,172 @@
+package logit
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"testing"
+)
+
+// testPassword - чувствительное значение с методом у значения.
+type testPassword string
+
+func (p testPassword) SensitiveValue() string { return string(p) }
+
+// testToken - чувствительное значение с методом у указателя.
+type testToken struct {
+	Raw string
+}
+
+func (t *testToken) SensitiveValue() string { return t.Raw }
+
+type testCredentials struct {
+	User     string         `json:"user"`
+	Password testPassword   `json:"password"`
+	Token    testToken      `json:"token"`
+	Backup   *testPassword  `json:"backup,omitempty"`
+	Empty    *testPassword  `json:"empty,omitempty"`
+	Skipped  testPassword   `json:"-"`
+	History  []testPassword `json:"history"`
+	Extra    map[string]any `json:"extra"`
+	testEmbedded
+}
+
+type testEmbedded struct {
+	Pin testPassword `json:"pin"`
+}
+
+// newTestSecretLogger возвращает логгер с выводом JSON в buf и, при заданном
+// redact, с правилами редактирования перед ним, как в MustNewLogger.
+func newTestSecretLogger(t *testing.T, buf *bytes.Buffer, conf *SecretConf, redact *RedactionConf) *zap.Logger {
+	t.Helper()
+	secrets, err := newSecretRenderer(conf)
+	if err != nil {
+		t.Fatalf("newSecretRenderer: %v", err)
+	}
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	core := newSecretCore(zapcore.NewCore(enc, zapcore.AddSync(buf), zapcore.DebugLevel), secrets, false)
+	if redact != nil {
+		r, err := newRedactor(redact)
+		if err != nil {
+			t.Fatalf("newRedactor: %v", err)
+		}
+		core = newRedactCore(core, r)
+	}
+	return zap.New(core)
+}
+
+func TestSensitiveNestedInReflectedValues(t *testing.T) {
+	backup := testPassword("backup-pass")
+	creds := testCredentials{
+		User:         "ivan",
+		Password:     "top-pass",
+		Token:        testToken{Raw: "tok-123"},
+		Backup:       &backup,
+		Skipped:      "skipped-pass",
+		History:      []testPassword{"old-pass-1", "old-pass-2"},
+		Extra:        map[string]any{"nested": map[string]any{"pw": testPassword("map-pass")}, "n": 1},
+		testEmbedded: testEmbedded{Pin: "1234-pin"},
+	}
+	secretValues := []string{"top-pass", "tok-123", "backup-pass", "skipped-pass", "old-pass", "map-pass", "1234-pin"}
+
+	redactions := map[string]*RedactionConf{
+		"без редактирования": nil,
+		"с редактированием":  {Defaults: true},
+	}
+	for name, redact := range redactions {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newTestSecretLogger(t, &buf, nil, redact)
+			logger.Info("login",
+				zap.Any("creds", creds),
+				zap.Reflect("ptr", &creds),
+				zap.Any("list", []testPassword{"old-pass-3"}),
+				zap.Any("map", map[string]testToken{"t": {Raw: "tok-123"}}),
+			)
+			line := buf.String()
+			for _, v := range secretValues {
+				if strings.Contains(line, v) {
+					t.Errorf("значение %q попало в лог: %s", v, line)
+				}
+			}
+
+			var got struct {
+				Creds map[string]any `json:"creds"`
+				List  []any          `json:"list"`
+			}
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("разбор %s: %v", line, err)
+			}
+			want := map[string]any{
+				"user":     "ivan",
+				"password": secretPlaceholder,
+				"token":    secretPlaceholder,
+				"backup":   secretPlaceholder,
+				"history":  []any{secretPlaceholder, secretPlaceholder},
+				"extra":    map[string]any{"nested": map[string]any{"pw": secretPlaceholder}, "n": float64(1)},
+				"pin":      secretPlaceholder,
+			}
+			wantJSON, _ := json.Marshal(want)
+			gotJSON, _ := json.Marshal(got.Creds)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("creds = %s, ожидалось %s", gotJSON, wantJSON)
+			}
+			if len(got.List) != 1 || got.List[0] != secretPlaceholder {
+				t.Errorf("list = %v", got.List)
+			}
+		})
+	}
+}
+
+func TestSensitiveNestedFingerprint(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestSecretLogger(t, &buf, &SecretConf{Mode: SecretFingerprint, Key: "k"}, nil)
+	logger.Info("m", zap.Any("a", []testPassword{"same"}), zap.Any("b", testPassword("same")))
+
+	var got struct {
+		A []string `json:"a"`
+		B string   `json:"b"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("разбор %s: %v", buf.String(), err)
+	}
+	if !strings.HasPrefix(got.B, "hmac:") || len(got.A) != 1 || got.A[0] != got.B {
+		t.Errorf("отпечатки вложенного и верхнего значения различаются: %+v", got)
+	}
+}
+
+func TestReflectedWithoutSensitiveUnchanged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestSecretLogger(t, &buf, nil, nil)
+	logger.Info("m", zap.Any("v", struct {
+		B int `json:"b"`
+		A int `json:"a"`
+	}{B: 1, A: 2}))
+	if want := `{"msg":"m","v":{"b":1,"a":2}}` + "\n"; buf.String() != want {
+		t.Errorf("запись = %q, ожидалось %q", buf.String(), want)
+	}
+}
+
+func TestSensitiveSiblingsKeepInt64Precision(t *testing.T) {
+	type account struct {
+		ID       int64        `json:"id"`
+		Limits   []int64      `json:"limits"`
+		Password testPassword `json:"password"`
+	}
+	for name, redact := range map[string]*RedactionConf{"secret": nil, "redact": {Defaults: true}} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newTestSecretLogger(t, &buf, nil, redact)
+			logger.Info("m", zap.Any("v", account{ID: 9007199254740993, Limits: []int64{9007199254740995}, Password: "p"}))
+			got := buf.String()
+			if !strings.Contains(got, `"id":9007199254740993`) || !strings.Contains(got, `"limits":[9007199254740995]`) {
+				t.Errorf("запись = %q, числа изменились", got)
+			}
+			if strings.Contains(got, `"password":"p"`) {
+				t.Errorf("запись = %q, пароль не скрыт", got)
+			}
+		})
+	}
+}
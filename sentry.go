@@ -0,0 +1,135 @@
+package logit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"net/http"
+	"time"
+)
+
+// sentryTransport - транспорт Sentry с дисковой очередью (Params.SentrySpool).
+// События сериализуются в конверты (envelope) и пишутся в спул, а фоновая
+// горутина batcher отправляет их по одному с повторами, поэтому события
+// переживают недоступность Sentry и перезапуск процесса.
+type sentryTransport struct {
+	b *batcher
+
+	// Задаются в Configure до первой отправки.
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+func newSentryTransport(params *Params) *sentryTransport {
+	t := &sentryTransport{}
+	t.b = newBatcher("Sentry", params.SentryBatch, t.send, params.errorHandler())
+	return t
+}
+
+// Configure вызывается SDK при создании клиента.
+func (t *sentryTransport) Configure(options sentry.ClientOptions) {
+	dsn, err := sentry.NewDsn(options.Dsn)
+	if err != nil {
+		return // sentry.Init уже вернул эту ошибку
+	}
+	t.url = dsn.GetAPIURL().String()
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=sentry.go/%s, sentry_key=%s", sentry.SDKVersion, dsn.GetPublicKey())
+	if dsn.GetSecretKey() != "" {
+		auth += ", sentry_secret=" + dsn.GetSecretKey()
+	}
+	t.header = http.Header{}
+	t.header.Set("X-Sentry-Auth", auth)
+	t.header.Set("Content-Type", "application/x-sentry-envelope")
+	t.header.Set("User-Agent", "sentry.go/"+sentry.SDKVersion)
+	t.client = options.HTTPClient
+	if t.client == nil {
+		t.client = &http.Client{Transport: options.HTTPTransport}
+	}
+}
+
+// SendEvent ставит событие в спул; отправка выполняется в фоне.
+func (t *sentryTransport) SendEvent(event *sentry.Event) {
+	envelope, err := sentryEnvelope(event)
+	if err != nil {
+		t.b.onError(fmt.Errorf("logger: %s: событие %s не сериализуется: %w", t.b.name, event.EventID, err))
+		return
+	}
+	t.b.add(remoteEntry{time: event.Timestamp, data: envelope})
+}
+
+// Flush дожидается отправки событий не дольше timeout и Batch.Timeout.
+// Со спулом события уже на диске, и Flush не ждет недоступный Sentry.
+func (t *sentryTransport) Flush(timeout time.Duration) bool {
+	done := make(chan error, 1)
+	go func() { done <- t.b.flush() }()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+// Close останавливает отправку; недоставленные события остаются в спуле.
+func (t *sentryTransport) Close() {
+	t.close()
+}
+
+// close вызывается из Close логгера.
+func (t *sentryTransport) close() {
+	if err := t.b.close(); err != nil {
+		t.b.onError(fmt.Errorf("logger: %s: закрытие: %w", t.b.name, err))
+	}
+}
+
+// send отправляет конверты по одному запросу на событие. После ошибки
+// повторяются только неотправленные события; событие, отклоненное Sentry
+// (4xx, кроме 408 и 429), отбрасывается, чтобы не задерживать остальные.
+func (t *sentryTransport) send(ctx context.Context, batch []remoteEntry) error {
+	for i, e := range batch {
+		_, err := postHTTP(ctx, t.client, t.url, t.header, e.data)
+		var permanent *permanentError
+		switch {
+		case err == nil:
+		case errors.As(err, &permanent):
+			t.b.failed(batch[i:i+1], err)
+		default:
+			return &partialError{entries: batch[i:], err: err}
+		}
+	}
+	return nil
+}
+
+// sentryEnvelope сериализует событие в конверт Sentry: заголовок конверта,
+// заголовок элемента и тело события, по строке на каждый.
+func sentryEnvelope(event *sentry.Event) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	itemType := "event"
+	if event.Type == "transaction" || event.Type == "check_in" {
+		itemType = event.Type
+	}
+	header, err := json.Marshal(map[string]any{
+		"event_id": event.EventID,
+		"sdk":      map[string]string{"name": event.Sdk.Name, "version": event.Sdk.Version},
+	})
+	if err != nil {
+		return nil, err
+	}
+	item, err := json.Marshal(map[string]any{"type": itemType, "length": len(body)})
+	if err != nil {
+		return nil, err
+	}
+	envelope := make([]byte, 0, len(header)+len(item)+len(body)+3)
+	envelope = append(append(envelope, header...), '\n')
+	envelope = append(append(envelope, item...), '\n')
+	envelope = append(append(envelope, body...), '\n')
+	return envelope, nil
+}
@@ -0,0 +1,144 @@
+package logit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/getsentry/sentry-go"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSentryTestTransport создает транспорт со спулом в dir, отправляющий
+// события на сервер с адресом url.
+func newSentryTestTransport(t *testing.T, url, dir string, onError func(error)) *sentryTransport {
+	t.Helper()
+	params := &Params{SentryBatch: testBatchConf(), ErrorHandler: onError}
+	tr := newSentryTransport(params)
+	tr.Configure(sentry.ClientOptions{Dsn: "http://key@" + strings.TrimPrefix(url, "http://") + "/1"})
+	if err := tr.b.startSpool(dir, &SpoolConf{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tr.close)
+	return tr
+}
+
+// waitRequests ждет, пока сервер получит n запросов.
+func waitRequests(t *testing.T, s *recordingServer, n int) []recordedRequest {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		requests := s.recorded()
+		if len(requests) >= n || time.Now().After(deadline) {
+			if len(requests) != n {
+				t.Fatalf("получено %d запросов, ожидалось %d", len(requests), n)
+			}
+			return requests
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// envelopeEventID разбирает конверт Sentry и возвращает идентификатор события.
+func envelopeEventID(t *testing.T, envelope []byte) string {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSuffix(envelope, []byte("\n")), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("в конверте %d строк, ожидалось 3: %s", len(lines), envelope)
+	}
+	var header struct {
+		EventID string `json:"event_id"`
+	}
+	var item struct {
+		Type   string `json:"type"`
+		Length int    `json:"length"`
+	}
+	var event sentry.Event
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		t.Fatalf("заголовок конверта: %v", err)
+	}
+	if err := json.Unmarshal(lines[1], &item); err != nil {
+		t.Fatalf("заголовок элемента: %v", err)
+	}
+	if err := json.Unmarshal(lines[2], &event); err != nil {
+		t.Fatalf("событие: %v", err)
+	}
+	if item.Type != "event" || item.Length != len(lines[2]) {
+		t.Errorf("элемент %+v, ожидался event длиной %d", item, len(lines[2]))
+	}
+	if header.EventID != string(event.EventID) {
+		t.Errorf("event_id конверта %q, события %q", header.EventID, event.EventID)
+	}
+	return header.EventID
+}
+
+func TestSentryTransportRetriesEnvelope(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusServiceUnavailable)
+	tr := newSentryTestTransport(t, srv.URL, t.TempDir(), nil)
+
+	tr.SendEvent(&sentry.Event{EventID: "0123456789abcdef0123456789abcdef", Message: "boom", Timestamp: time.Now()})
+	tr.Flush(time.Second)
+	requests := waitRequests(t, srv, 2)
+
+	for _, r := range requests {
+		if r.path != "/api/1/envelope/" {
+			t.Errorf("путь %q, ожидался /api/1/envelope/", r.path)
+		}
+		if auth := r.header.Get("X-Sentry-Auth"); !strings.Contains(auth, "sentry_key=key") {
+			t.Errorf("X-Sentry-Auth %q без ключа", auth)
+		}
+		if ct := r.header.Get("Content-Type"); ct != "application/x-sentry-envelope" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		if id := envelopeEventID(t, r.body); id != "0123456789abcdef0123456789abcdef" {
+			t.Errorf("event_id %q", id)
+		}
+	}
+}
+
+func TestSentryTransportDropsRejectedEvent(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusBadRequest)
+	var mu sync.Mutex
+	var errs []error
+	tr := newSentryTestTransport(t, srv.URL, t.TempDir(), func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	tr.SendEvent(&sentry.Event{EventID: "00000000000000000000000000000001", Timestamp: time.Now()})
+	tr.SendEvent(&sentry.Event{EventID: "00000000000000000000000000000002", Timestamp: time.Now()})
+	if !tr.Flush(2 * time.Second) {
+		t.Error("Flush не дождался отправки")
+	}
+	requests := waitRequests(t, srv, 2)
+
+	if id := envelopeEventID(t, requests[1].body); id != "00000000000000000000000000000002" {
+		t.Errorf("вторым отправлено событие %q", id)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var permanent *permanentError
+	if len(errs) != 1 || !errors.As(errs[0], &permanent) {
+		t.Errorf("ошибки %v, ожидалась одна об отклоненном событии", errs)
+	}
+}
+
+func TestSentryTransportKeepsEventsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	down := newRecordingServer(t)
+	down.Close()
+	tr := newSentryTestTransport(t, down.URL, dir, func(error) {})
+	tr.SendEvent(&sentry.Event{EventID: "0000000000000000000000000000000a", Timestamp: time.Now()})
+	tr.close()
+
+	srv := newRecordingServer(t)
+	newSentryTestTransport(t, srv.URL, dir, nil)
+	requests := waitRequests(t, srv, 1)
+	if id := envelopeEventID(t, requests[0].body); id != "0000000000000000000000000000000a" {
+		t.Errorf("после перезапуска отправлено событие %q", id)
+	}
+}
@@ -0,0 +1,162 @@
+package logit
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"log/slog"
+)
+
+// slogCallerSkip - число кадров между кодом приложения и вызовом Check в
+// slogHandler.Handle: slog.(*Logger).Info и т.п., slog.(*Logger).log, Handle.
+const slogCallerSkip = 3
+
+// NewSlogHandler возвращает slog.Handler, который пишет записи через логгер l.
+// op и traceId берутся из контекста записи (slog.InfoContext и т.п.), место
+// вызова - из slog.Record.PC. Для логгеров, созданных не через MustNewLogger,
+// возвращается обработчик, отбрасывающий записи.
+func NewSlogHandler(l Logger) slog.Handler {
+	li, ok := l.(*logIt)
+	if !ok {
+		return slog.DiscardHandler
+	}
+	return &slogHandler{
+		base:   li,
+		logger: li.logger.WithOptions(zap.AddCallerSkip(slogCallerSkip - callerSkip)),
+	}
+}
+
+type slogHandler struct {
+	base   *logIt
+	logger *zap.Logger
+	groups []slogGroup // открытые через WithGroup группы, от внешней к внутренней
+}
+
+// slogGroup - группа slog и атрибуты, добавленные в нее через WithAttrs.
+type slogGroup struct {
+	name  string
+	attrs []slog.Attr
+}
+
+func (h *slogHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return h.logger.Core().Enabled(slogLevel(lvl))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	ce := h.logger.Check(slogLevel(r.Level), r.Message)
+	if ce == nil {
+		return nil
+	}
+	if !r.Time.IsZero() {
+		ce.Time = r.Time
+	}
+	if ce.Caller.Defined && r.PC != 0 {
+		ce.Caller = frameCaller(r.PC)
+	}
+
+	fields := make([]zap.Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, a)
+		return true
+	})
+	// Атрибуты записи вкладываются в открытые группы, начиная с самой внутренней.
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		g := h.groups[i]
+		groupFields := make([]zap.Field, 0, len(g.attrs)+len(fields))
+		for _, a := range g.attrs {
+			groupFields = appendSlogAttr(groupFields, a)
+		}
+		groupFields = append(groupFields, fields...)
+		if len(groupFields) == 0 {
+			fields = nil
+			continue
+		}
+		fields = []zap.Field{zap.Object(g.name, zapFields(groupFields))}
+	}
+
+	ce.Write(h.base.contextFields(ctx, fields)...)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	if len(h.groups) == 0 {
+		var fields []zap.Field
+		for _, a := range attrs {
+			fields = appendSlogAttr(fields, a)
+		}
+		clone.logger = h.logger.With(fields...)
+		return &clone
+	}
+	clone.groups = append([]slogGroup(nil), h.groups...)
+	last := &clone.groups[len(clone.groups)-1]
+	last.attrs = append(append([]slog.Attr(nil), last.attrs...), attrs...)
+	return &clone
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append([]slogGroup(nil), h.groups...), slogGroup{name: name})
+	return &clone
+}
+
+// appendSlogAttr преобразует атрибут slog в поля zap.
+func appendSlogAttr(fields []zap.Field, a slog.Attr) []zap.Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		var group []zap.Field
+		for _, ga := range a.Value.Group() {
+			group = appendSlogAttr(group, ga)
+		}
+		if len(group) == 0 {
+			return fields
+		}
+		if a.Key == "" {
+			return append(fields, group...) // группа без имени встраивается
+		}
+		return append(fields, zap.Object(a.Key, zapFields(group)))
+	case slog.KindString:
+		return append(fields, zap.String(a.Key, a.Value.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(a.Key, a.Value.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(a.Key, a.Value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(a.Key, a.Value.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(a.Key, a.Value.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(a.Key, a.Value.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(a.Key, a.Value.Time()))
+	default:
+		if err, ok := a.Value.Any().(error); ok {
+			return append(fields, zap.NamedError(a.Key, err))
+		}
+		return append(fields, zap.Any(a.Key, a.Value.Any()))
+	}
+}
+
+// slogLevel переводит уровень slog в уровень zap.
+func slogLevel(lvl slog.Level) zapcore.Level {
+	switch {
+	case lvl >= slog.LevelError:
+		return zapcore.ErrorLevel
+	case lvl >= slog.LevelWarn:
+		return zapcore.WarnLevel
+	case lvl >= slog.LevelInfo:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
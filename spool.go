@@ -0,0 +1,397 @@
+package logit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры спула по умолчанию.
+const (
+	defaultSpoolSegmentBytes = 8 << 20
+	defaultSpoolMaxBytes     = 256 << 20
+)
+
+const (
+	spoolSegmentExt  = ".seg"
+	spoolCursorFile  = "cursor"
+	spoolRecordHead  = 8  // длина и CRC32 записи
+	spoolPayloadHead = 10 // время и длина ключа
+)
+
+var (
+	errSpoolFull       = errors.New("превышен размер спула")
+	errSpoolKeyTooLong = fmt.Errorf("ключ записи длиннее %d байт", math.MaxUint16)
+)
+
+// SpoolConf задает дисковую очередь удаленного вывода. Записи сначала пишутся
+// в сегменты на диске и удаляются после доставки, поэтому переживают
+// недоступность приемника и перезапуск процесса. Спул задается для выводов
+// с пакетной отправкой (OutputConf.Spool) и для событий Sentry (Params.SentrySpool).
+// Ключ записи (например, ключ сообщения Kafka) ограничен 65535 байтами, записи
+// с более длинным ключом отбрасываются с ошибкой.
+type SpoolConf struct {
+	// Dir - каталог сегментов относительно LoggerConf.Dir; по умолчанию spool/<тип вывода>.
+	// У каждого вывода должен быть свой каталог.
+	Dir          string `yaml:"dir" json:"dir"`
+	SegmentBytes int64  `yaml:"segmentBytes" json:"segmentBytes"` // размер сегмента; по умолчанию 8 МБ
+	// MaxBytes ограничивает место на диске; по умолчанию 256 МБ. Записи сверх
+	// лимита отбрасываются.
+	MaxBytes int64 `yaml:"maxBytes" json:"maxBytes"`
+}
+
+// spoolDir возвращает каталог спула вывода.
+func (p *Params) spoolDir(out OutputConf) string {
+	dir := out.Spool.Dir
+	if dir == "" {
+		dir = filepath.Join("spool", out.Type)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(p.LoggerConf.Dir, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// spoolSegment - файл сегмента.
+type spoolSegment struct {
+	seq  uint64
+	size int64
+}
+
+// spool - очередь записей в файлах сегментов <seq>.seg. Запись сегмента:
+// длина (4 байта), CRC32 (4 байта), время в наносекундах (8 байт), длина
+// ключа (2 байта), ключ и данные. Файл cursor хранит позицию первой
+// недоставленной записи. Используется под мьютексом batcher.
+type spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+
+	segments  []spoolSegment // по возрастанию; последний - сегмент записи
+	w         *os.File
+	diskBytes int64
+
+	r          *os.File // читаемый сегмент
+	rseq, roff uint64   // позиция чтения
+	cseq, coff uint64   // позиция подтвержденной доставки
+}
+
+// openSpool открывает каталог спула и возвращает число и размер недоставленных
+// записей. Запись всегда продолжается в новом сегменте, поэтому оборванная
+// при сбое запись в конце старого сегмента просто завершает его чтение.
+func openSpool(dir string, conf *SpoolConf) (*spool, int, int, error) {
+	s := &spool{dir: dir, segmentBytes: conf.SegmentBytes, maxBytes: conf.MaxBytes}
+	if s.segmentBytes <= 0 {
+		s.segmentBytes = defaultSpoolSegmentBytes
+	}
+	if s.maxBytes <= 0 {
+		s.maxBytes = defaultSpoolMaxBytes
+	}
+	if s.maxBytes < s.segmentBytes {
+		s.segmentBytes = s.maxBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, 0, 0, fmt.Errorf("logger: каталог спула: %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("logger: каталог спула: %w", err)
+	}
+	for _, f := range files {
+		name := f.Name()
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if f.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) || err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("logger: каталог спула: %w", err)
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq, size: info.Size()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	if cursor, err := os.ReadFile(filepath.Join(dir, spoolCursorFile)); err == nil && len(cursor) == 16 {
+		s.cseq = binary.BigEndian.Uint64(cursor)
+		s.coff = binary.BigEndian.Uint64(cursor[8:])
+	} else if len(s.segments) > 0 {
+		s.cseq = s.segments[0].seq
+	}
+	// Сегменты до курсора уже доставлены.
+	for len(s.segments) > 0 && s.segments[0].seq < s.cseq {
+		_ = os.Remove(s.segmentPath(s.segments[0].seq))
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].seq > s.cseq {
+		s.cseq, s.coff = s.segments[0].seq, 0
+	}
+
+	entries, size := 0, 0
+	for _, seg := range s.segments {
+		s.diskBytes += seg.size
+		off := uint64(0)
+		if seg.seq == s.cseq {
+			off = s.coff
+		}
+		n, bytes, err := s.count(seg.seq, off)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		entries += n
+		size += bytes
+	}
+
+	next := s.cseq
+	if len(s.segments) > 0 {
+		next = s.segments[len(s.segments)-1].seq + 1
+	}
+	if entries == 0 {
+		// Все доставлено: старые сегменты не нужны.
+		for _, seg := range s.segments {
+			_ = os.Remove(s.segmentPath(seg.seq))
+		}
+		s.segments, s.diskBytes = nil, 0
+		s.cseq, s.coff = next, 0
+	}
+	if err := s.create(next); err != nil {
+		return nil, 0, 0, err
+	}
+	s.rseq, s.roff = s.cseq, s.coff
+	return s, entries, size, nil
+}
+
+func (s *spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", seq, spoolSegmentExt))
+}
+
+// count считает целые записи сегмента начиная с off.
+func (s *spool) count(seq, off uint64) (int, int, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, 0, fmt.Errorf("logger: сегмент спула: %w", err)
+	}
+	defer f.Close()
+	entries, size := 0, 0
+	for {
+		e, n, err := readSpoolRecord(f, off)
+		if err != nil {
+			return entries, size, nil
+		}
+		entries++
+		size += len(e.data)
+		off += n
+	}
+}
+
+// create начинает новый сегмент записи.
+func (s *spool) create(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("logger: сегмент спула: %w", err)
+	}
+	if s.w != nil {
+		_ = s.w.Close()
+	}
+	s.w = f
+	s.segments = append(s.segments, spoolSegment{seq: seq})
+	return nil
+}
+
+// append дописывает запись в сегмент записи.
+func (s *spool) append(e remoteEntry) error {
+	if len(e.key) > math.MaxUint16 {
+		return errSpoolKeyTooLong
+	}
+	payload := make([]byte, spoolPayloadHead, spoolPayloadHead+len(e.key)+len(e.data))
+	binary.BigEndian.PutUint64(payload, uint64(e.time.UnixNano()))
+	binary.BigEndian.PutUint16(payload[8:], uint16(len(e.key)))
+	payload = append(append(payload, e.key...), e.data...)
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	if s.diskBytes+int64(len(record)) > s.maxBytes {
+		return errSpoolFull
+	}
+	last := &s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+int64(len(record)) > s.segmentBytes {
+		if err := s.create(last.seq + 1); err != nil {
+			return err
+		}
+		last = &s.segments[len(s.segments)-1]
+	}
+	n, err := s.w.Write(record)
+	if err != nil {
+		if n > 0 {
+			if rerr := s.discardPartial(last.size); rerr != nil {
+				return errors.Join(err, rerr)
+			}
+		}
+		return err
+	}
+	last.size += int64(n)
+	s.diskBytes += int64(n)
+	return nil
+}
+
+// discardPartial убирает оборванную запись в конце сегмента записи, обрезая
+// его до size. Иначе чтение остановилось бы на ней и не дошло до следующих
+// записей. Если обрезать не удалось, запись продолжается в новом сегменте,
+// а оборванная запись завершает чтение старого.
+func (s *spool) discardPartial(size int64) error {
+	last := &s.segments[len(s.segments)-1]
+	err := s.w.Truncate(size)
+	if err == nil {
+		_, err = s.w.Seek(size, io.SeekStart)
+	}
+	if err == nil {
+		return nil
+	}
+	if info, serr := s.w.Stat(); serr == nil {
+		s.diskBytes += info.Size() - last.size
+		last.size = info.Size()
+	}
+	return s.create(last.seq + 1)
+}
+
+// read читает следующие записи, не подтверждая их доставку.
+func (s *spool) read(maxEntries, maxBytes int) ([]remoteEntry, error) {
+	var batch []remoteEntry
+	size := 0
+	for len(batch) < maxEntries {
+		if s.r == nil {
+			f, err := os.Open(s.segmentPath(s.rseq))
+			if err != nil {
+				return batch, fmt.Errorf("logger: сегмент спула: %w", err)
+			}
+			s.r = f
+		}
+		e, n, err := readSpoolRecord(s.r, s.roff)
+		if err != nil {
+			// Конец сегмента: переходим к следующему, если он есть.
+			if s.rseq >= s.segments[len(s.segments)-1].seq {
+				break
+			}
+			_ = s.r.Close()
+			s.r = nil
+			s.rseq, s.roff = s.nextSeq(s.rseq), 0
+			continue
+		}
+		if len(batch) > 0 && size+len(e.data) > maxBytes {
+			break
+		}
+		batch = append(batch, e)
+		size += len(e.data)
+		s.roff += n
+	}
+	return batch, nil
+}
+
+func (s *spool) nextSeq(seq uint64) uint64 {
+	for _, seg := range s.segments {
+		if seg.seq > seq {
+			return seg.seq
+		}
+	}
+	return seq
+}
+
+// commit подтверждает доставку прочитанных записей: сохраняет курсор
+// и удаляет прочитанные сегменты.
+func (s *spool) commit() error {
+	// Полностью прочитанный сегмент удаляется сразу, не дожидаясь следующего чтения.
+	for _, seg := range s.segments[:len(s.segments)-1] {
+		if seg.seq == s.rseq && int64(s.roff) >= seg.size {
+			if s.r != nil {
+				_ = s.r.Close()
+				s.r = nil
+			}
+			s.rseq, s.roff = s.nextSeq(s.rseq), 0
+		}
+	}
+	s.cseq, s.coff = s.rseq, s.roff
+	cursor := binary.BigEndian.AppendUint64(nil, s.cseq)
+	cursor = binary.BigEndian.AppendUint64(cursor, s.coff)
+	tmp := filepath.Join(s.dir, spoolCursorFile+".tmp")
+	if err := os.WriteFile(tmp, cursor, 0o644); err != nil {
+		return fmt.Errorf("logger: курсор спула: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, spoolCursorFile)); err != nil {
+		return fmt.Errorf("logger: курсор спула: %w", err)
+	}
+	for len(s.segments) > 1 && s.segments[0].seq < s.cseq {
+		if err := os.Remove(s.segmentPath(s.segments[0].seq)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("logger: сегмент спула: %w", err)
+		}
+		s.diskBytes -= s.segments[0].size
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// sync сбрасывает сегмент записи на диск.
+func (s *spool) sync() error {
+	return s.w.Sync()
+}
+
+// close закрывает файлы сегментов.
+func (s *spool) close() error {
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	return s.w.Close()
+}
+
+// readSpoolRecord читает запись по смещению off и возвращает ее размер в файле.
+// Неполная или поврежденная запись считается концом сегмента.
+func readSpoolRecord(f *os.File, off uint64) (remoteEntry, uint64, error) {
+	var head [spoolRecordHead]byte
+	if _, err := f.ReadAt(head[:], int64(off)); err != nil {
+		return remoteEntry{}, 0, err
+	}
+	size := binary.BigEndian.Uint32(head[:])
+	if size < spoolPayloadHead {
+		return remoteEntry{}, 0, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, size)
+	if _, err := f.ReadAt(payload, int64(off)+spoolRecordHead); err != nil {
+		return remoteEntry{}, 0, err
+	}
+	keyLen := int(binary.BigEndian.Uint16(payload[8:]))
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(head[4:]) || spoolPayloadHead+keyLen > len(payload) {
+		return remoteEntry{}, 0, io.ErrUnexpectedEOF
+	}
+	return remoteEntry{
+		time: time.Unix(0, int64(binary.BigEndian.Uint64(payload))),
+		key:  string(payload[spoolPayloadHead : spoolPayloadHead+keyLen]),
+		data: payload[spoolPayloadHead+keyLen:],
+	}, spoolRecordHead + uint64(size), nil
+}
+
+// startSpool переводит очередь на спул в каталоге dir. Недоставленные записи
+// из прошлых запусков отправляются первыми. Вызывается до первой записи.
+func (b *batcher) startSpool(dir string, conf *SpoolConf) error {
+	s, entries, size, err := openSpool(dir, conf)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.spool = s
+	b.entries += entries
+	b.bytes += size
+	b.flushNow = entries > 0
+	b.mu.Unlock()
+	b.signal()
+	return nil
+}
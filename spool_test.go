@@ -0,0 +1,160 @@
+package logit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSpool(t *testing.T) *spool {
+	t.Helper()
+	s, _, _, err := openSpool(t.TempDir(), &SpoolConf{})
+	if err != nil {
+		t.Fatalf("openSpool: %v", err)
+	}
+	t.Cleanup(func() { _ = s.w.Close() })
+	return s
+}
+
+func spoolEntry(data string) remoteEntry {
+	return remoteEntry{key: "k", time: time.Unix(1, 0), data: []byte(data)}
+}
+
+func assertSpoolRead(t *testing.T, s *spool, want ...string) {
+	t.Helper()
+	batch, err := s.read(100, 1<<20)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var got []string
+	for _, e := range batch {
+		got = append(got, string(e.data))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("прочитано %q, ожидалось %q", got, want)
+	}
+}
+
+func TestSpoolTruncatesPartialRecord(t *testing.T) {
+	s := newTestSpool(t)
+	if err := s.append(spoolEntry("first")); err != nil {
+		t.Fatal(err)
+	}
+	size := s.segments[0].size
+
+	// Оборванная запись, как после записи с ошибкой ENOSPC.
+	if _, err := s.w.Write([]byte{0, 0, 0, 40, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.discardPartial(size); err != nil {
+		t.Fatalf("discardPartial: %v", err)
+	}
+	if err := s.append(spoolEntry("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.segments) != 1 {
+		t.Errorf("сегментов %d, ожидался один", len(s.segments))
+	}
+	assertSpoolRead(t, s, "first", "second")
+	if err := s.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := openSpoolEntries(s.dir); err != nil || got != 0 {
+		t.Errorf("после повторного открытия недоставлено %d (%v), ожидалось 0", got, err)
+	}
+}
+
+func TestSpoolRotatesWhenTruncateFails(t *testing.T) {
+	s := newTestSpool(t)
+	if err := s.append(spoolEntry("first")); err != nil {
+		t.Fatal(err)
+	}
+	size := s.segments[0].size
+	if _, err := s.w.Write([]byte{0, 0, 0, 40, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.w.Close() // Truncate на закрытом файле не удастся
+
+	if err := s.discardPartial(size); err != nil {
+		t.Fatalf("discardPartial: %v", err)
+	}
+	if err := s.append(spoolEntry("second")); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.segments) != 2 {
+		t.Fatalf("сегментов %d, ожидалось два", len(s.segments))
+	}
+	assertSpoolRead(t, s, "first", "second")
+	if err := s.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.segments) != 1 {
+		t.Errorf("после подтверждения сегментов %d, ожидался один", len(s.segments))
+	}
+}
+
+func TestSpoolRejectsLongKey(t *testing.T) {
+	s := newTestSpool(t)
+	long := remoteEntry{key: strings.Repeat("k", math.MaxUint16+1), data: []byte("long")}
+	if err := s.append(long); !errors.Is(err, errSpoolKeyTooLong) {
+		t.Fatalf("append: %v, ожидалась errSpoolKeyTooLong", err)
+	}
+	if s.diskBytes != 0 {
+		t.Errorf("на диске %d байт, ожидалось 0", s.diskBytes)
+	}
+
+	limit := remoteEntry{key: strings.Repeat("k", math.MaxUint16), data: []byte("limit")}
+	if err := s.append(limit); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	batch, err := s.read(10, 1<<20)
+	if err != nil || len(batch) != 1 {
+		t.Fatalf("read: %d записей, %v", len(batch), err)
+	}
+	if batch[0].key != limit.key || string(batch[0].data) != "limit" {
+		t.Errorf("ключ %d байт, данные %q", len(batch[0].key), batch[0].data)
+	}
+}
+
+func TestBatcherReportsEveryRejectedKey(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	b := newBatcher("test", testBatchConf(), func(context.Context, []remoteEntry) error { return nil }, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+	t.Cleanup(func() { _ = b.close() })
+	if err := b.startSpool(t.TempDir(), &SpoolConf{}); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("k", math.MaxUint16+1)
+	b.add(remoteEntry{key: long, data: []byte("a")})
+	b.add(remoteEntry{key: long, data: []byte("b")})
+	b.add(remoteEntry{key: "k", data: []byte("c")})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 || !errors.Is(errs[0], errSpoolKeyTooLong) {
+		t.Errorf("ошибки %v, ожидались две errSpoolKeyTooLong", errs)
+	}
+	if stats := b.stats(); stats.Dropped != 2 || stats.Entries != 1 {
+		t.Errorf("Dropped=%d Entries=%d, ожидалось 2 и 1", stats.Dropped, stats.Entries)
+	}
+}
+
+// openSpoolEntries открывает спул заново и возвращает число недоставленных записей.
+func openSpoolEntries(dir string) (int, error) {
+	s, entries, _, err := openSpool(dir, &SpoolConf{})
+	if err != nil {
+		return 0, err
+	}
+	_ = s.w.Close()
+	return entries, nil
+}
@@ -0,0 +1,249 @@
+package logit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// stderr - исходный os.Stderr процесса. Консольный вывод и внутренние ошибки
+// логгера пишут в него, а не в os.Stderr, чтобы после RedirectStderr записи
+// не возвращались в логгер по кругу.
+var stderr = os.Stderr
+
+// sourceKey - поле с источником строк, перенаправленных в логгер.
+const sourceKey = "source"
+
+// Источники перенаправленного вывода.
+const (
+	SourceStdLog = "stdlog"
+	SourceStderr = "stderr"
+)
+
+// maxLineSize - размер неполной строки, после которого она пишется без ожидания '\n'.
+const maxLineSize = 64 * 1024
+
+// stdLogCallerSkip - кадры пакета log между кодом приложения и LineWriter.Write:
+// log.Printf и т.п. и log.(*Logger).output.
+const stdLogCallerSkip = 2
+
+// levelPrefixes - распознаваемые префиксы уровня. Более длинные префиксы идут
+// раньше совпадающих с ними коротких.
+var levelPrefixes = []struct {
+	prefix string
+	level  zapcore.Level
+}{
+	{"ERROR", zapcore.ErrorLevel},
+	{"ERR", zapcore.ErrorLevel},
+	{"FATAL", zapcore.ErrorLevel},
+	{"PANIC", zapcore.ErrorLevel},
+	{"CRITICAL", zapcore.ErrorLevel},
+	{"WARNING", zapcore.WarnLevel},
+	{"WARN", zapcore.WarnLevel},
+	{"INFO", zapcore.InfoLevel},
+	{"DEBUG", zapcore.DebugLevel},
+	{"TRACE", zapcore.DebugLevel},
+}
+
+// LineWriter - io.Writer, превращающий каждую записанную строку в запись логгера
+// с полем source. Уровень берется из префикса строки ("ERROR: ...", "[WARN] ..."),
+// а если префикса нет - используется уровень по умолчанию. Неполная строка
+// накапливается до '\n' или до вызова Flush.
+type LineWriter struct {
+	base   Logger
+	logger *zap.Logger // nil, если base создан не через MustNewLogger
+	level  zapcore.Level
+	source string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewLineWriter создает LineWriter с уровнем по умолчанию level и источником source.
+// Местом вызова считается код, вызвавший Write.
+func NewLineWriter(l Logger, level zapcore.Level, source string) *LineWriter {
+	return newLineWriter(l, level, source, 0)
+}
+
+func newLineWriter(l Logger, level zapcore.Level, source string, skip int) *LineWriter {
+	w := &LineWriter{base: l, level: level, source: source}
+	if li, ok := l.(*logIt); ok {
+		// Между Write и logger.Check один кадр (emit), как между публичным методом
+		// logIt и Check, поэтому достаточно callerSkip логгера и skip вызывающих кадров.
+		w.logger = li.logger.WithOptions(zap.AddCallerSkip(skip))
+	}
+	return w
+}
+
+// Write пишет каждую полную строку p отдельной записью.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLineSize {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil // не удерживаем прочитанный массив
+	}
+	return len(p), nil
+}
+
+// Flush пишет накопленную неполную строку.
+func (w *LineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *LineWriter) emit(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	lvl, msg := detectLevel(line, w.level)
+	source := zap.String(sourceKey, w.source)
+	ctx := context.Background()
+
+	if w.logger != nil {
+		ce := w.logger.Check(lvl, msg)
+		if ce == nil {
+			return
+		}
+		li := w.base.(*logIt)
+		ce.Write(li.contextFields(ctx, []zap.Field{source})...)
+		if lvl >= zapcore.ErrorLevel {
+			// Как и Logger.Error, ошибки отправляются в Sentry.
+			li.capture(ctx, errors.New(msg), []zap.Field{source})
+		}
+		return
+	}
+	switch lvl {
+	case zapcore.DebugLevel:
+		w.base.Debug(ctx, msg, source)
+	case zapcore.InfoLevel:
+		w.base.Info(ctx, msg, source)
+	case zapcore.WarnLevel:
+		w.base.Warn(ctx, msg, source)
+	default:
+		w.base.Error(ctx, errors.New(msg), source)
+	}
+}
+
+// detectLevel ищет в начале строки префикс уровня и возвращает уровень и строку
+// без префикса. Если префикса нет, возвращается def и исходная строка.
+func detectLevel(line string, def zapcore.Level) (zapcore.Level, string) {
+	s := strings.TrimLeft(line, " \t")
+	bracket := strings.HasPrefix(s, "[")
+	if bracket {
+		s = s[1:]
+	}
+	for _, p := range levelPrefixes {
+		if len(s) < len(p.prefix) || !strings.EqualFold(s[:len(p.prefix)], p.prefix) {
+			continue
+		}
+		rest := s[len(p.prefix):]
+		if rest != "" && !strings.ContainsRune("]: \t|-", rune(rest[0])) {
+			continue // например, "Information" или "errors"
+		}
+		if bracket {
+			if !strings.HasPrefix(rest, "]") {
+				continue
+			}
+			rest = rest[1:]
+		}
+		rest = strings.TrimLeft(rest, ":|- \t")
+		if rest == "" {
+			return p.level, line
+		}
+		return p.level, rest
+	}
+	return def, line
+}
+
+// RedirectStdLog направляет вывод стандартного пакета log в логгер: каждая строка
+// становится записью уровня level (или уровня из префикса строки) с полем
+// source=stdlog. Флаги и префикс log сбрасываются, так как время и уровень
+// добавляет логгер. Возвращает функцию, восстанавливающую прежние настройки log.
+func RedirectStdLog(l Logger, level zapcore.Level) (restore func()) {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	w := newLineWriter(l, level, SourceStdLog, stdLogCallerSkip)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(w)
+	return func() {
+		w.Flush()
+		log.SetOutput(out)
+		log.SetPrefix(prefix)
+		log.SetFlags(flags)
+	}
+}
+
+// RedirectStderr подменяет os.Stderr каналом, строки из которого пишутся в логгер
+// уровнем level (или уровнем из префикса строки) с полем source=stderr.
+// Перехватываются только записи Go-кода через os.Stderr, сделанные после вызова;
+// вывод среды выполнения Go и C-библиотек напрямую в дескриптор 2 не перехватывается.
+// Место вызова в таких записях не указывается. Возвращает функцию, которая
+// восстанавливает os.Stderr и дожидается записи оставшихся строк.
+func RedirectStderr(l Logger, level zapcore.Level) (restore func(), err error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("logger: создание канала для stderr: %w", err)
+	}
+	w := newLineWriter(l, level, SourceStderr, 0)
+	if w.logger != nil {
+		w.logger = w.logger.WithOptions(zap.WithCaller(false))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader := bufio.NewReaderSize(r, maxLineSize)
+		for {
+			line, err := reader.ReadSlice('\n')
+			if len(line) > 0 {
+				_, _ = w.Write(line)
+			}
+			if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+				if !errors.Is(err, io.EOF) {
+					stderrErrorHandler(fmt.Errorf("чтение перенаправленного stderr: %w", err))
+				}
+				break
+			}
+		}
+		w.Flush()
+		_ = r.Close()
+	}()
+
+	orig := os.Stderr
+	os.Stderr = pw
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Stderr = orig
+			_ = pw.Close()
+			<-done
+		})
+	}, nil
+}
@@ -0,0 +1,70 @@
+package logit
+
+import (
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSentryTransport запоминает события вместо отправки в Sentry.
+type recordingSentryTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingSentryTransport) Configure(sentry.ClientOptions) {}
+
+func (t *recordingSentryTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingSentryTransport) Flush(time.Duration) bool { return true }
+
+func (t *recordingSentryTransport) Close() {}
+
+func (t *recordingSentryTransport) recorded() []*sentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*sentry.Event(nil), t.events...)
+}
+
+// bindSentryTestClient подключает к текущему хабу клиент Sentry с
+// recordingSentryTransport и восстанавливает прежний клиент после теста.
+func bindSentryTestClient(t *testing.T) *recordingSentryTransport {
+	t.Helper()
+	transport := &recordingSentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: "http://key@127.0.0.1/1", Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := sentry.CurrentHub()
+	prev := hub.Client()
+	hub.BindClient(client)
+	t.Cleanup(func() { hub.BindClient(prev) })
+	return transport
+}
+
+func TestLineWriterCapturesErrors(t *testing.T) {
+	transport := bindSentryTestClient(t)
+	l := newOutputTestLogger(t, OutputConf{Type: OutputFile})
+	w := NewLineWriter(l, zapcore.InfoLevel, "worker")
+
+	if _, err := w.Write([]byte("started\nWARN: slow\nERROR: connection refused\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	events := transport.recorded()
+	if len(events) != 1 {
+		t.Fatalf("событий Sentry: %d, ожидалось одно для строки ERROR", len(events))
+	}
+	if len(events[0].Exception) == 0 || events[0].Exception[len(events[0].Exception)-1].Value != "connection refused" {
+		t.Errorf("исключение %+v, ожидалось connection refused", events[0].Exception)
+	}
+	if fields, ok := events[0].Contexts["fields"]; !ok || fields[sourceKey] != "worker" {
+		t.Errorf("контекст fields %v, ожидался source=worker", events[0].Contexts["fields"])
+	}
+}
@@ -0,0 +1,135 @@
+package logit
+
+import (
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncMode определяет, когда файловый вывод вызывает fsync.
+type SyncMode string
+
+const (
+	SyncNever    SyncMode = "never"    // fsync только при явном Sync и для уровней выше Error
+	SyncEveryN   SyncMode = "everyN"   // fsync после каждых N записей
+	SyncInterval SyncMode = "interval" // fsync раз в Interval, если были записи
+	SyncOnError  SyncMode = "onError"  // fsync после каждой записи уровня Error и выше
+)
+
+// SyncPolicy - политика fsync для файлового вывода.
+type SyncPolicy struct {
+	Mode     SyncMode      `yaml:"mode" json:"mode"`
+	N        int           `yaml:"n" json:"n"`               // для SyncEveryN
+	Interval time.Duration `yaml:"interval" json:"interval"` // для SyncInterval
+}
+
+// validate проверяет параметры политики.
+func (p SyncPolicy) validate() error {
+	switch p.Mode {
+	case "", SyncNever, SyncOnError:
+	case SyncEveryN:
+		if p.N <= 0 {
+			return fmt.Errorf("logger: для политики fsync %q требуется N > 0", p.Mode)
+		}
+	case SyncInterval:
+		if p.Interval <= 0 {
+			return fmt.Errorf("logger: для политики fsync %q требуется Interval > 0", p.Mode)
+		}
+	default:
+		return fmt.Errorf("logger: неизвестная политика fsync %q", p.Mode)
+	}
+	return nil
+}
+
+// syncCore вызывает Sync у writer согласно политике после записи в оборачиваемое ядро.
+type syncCore struct {
+	zapcore.Core
+	ws      zapcore.WriteSyncer
+	policy  SyncPolicy
+	state   *syncState // общее для всех ядер, полученных через With
+	onError func(error)
+}
+
+type syncState struct {
+	count    atomic.Int64
+	dirty    atomic.Bool
+	stop     chan struct{} // закрывается в close
+	stopOnce sync.Once
+}
+
+// newSyncCore оборачивает core политикой policy, проверенной validate. Для
+// SyncInterval запускается фоновая горутина, которая работает до Close логгера.
+func newSyncCore(core zapcore.Core, ws zapcore.WriteSyncer, policy SyncPolicy, onError func(error)) zapcore.Core {
+	if policy.Mode == "" || policy.Mode == SyncNever {
+		return core
+	}
+	c := &syncCore{
+		Core:    core,
+		ws:      ws,
+		policy:  policy,
+		state:   &syncState{stop: make(chan struct{})},
+		onError: onError,
+	}
+	if policy.Mode == SyncInterval {
+		go c.runTicker()
+	}
+	return c
+}
+
+func (c *syncCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	return &clone
+}
+
+func (c *syncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if err := c.Core.Write(ent, fields); err != nil {
+		return err
+	}
+
+	switch c.policy.Mode {
+	case SyncEveryN:
+		if c.state.count.Add(1)%int64(c.policy.N) == 0 {
+			return c.ws.Sync()
+		}
+	case SyncOnError:
+		if ent.Level >= zapcore.ErrorLevel {
+			return c.ws.Sync()
+		}
+	case SyncInterval:
+		c.state.dirty.Store(true)
+	}
+	return nil
+}
+
+func (c *syncCore) runTicker() {
+	ticker := time.NewTicker(c.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.state.stop:
+			return
+		case <-ticker.C:
+		}
+		if !c.state.dirty.Swap(false) {
+			continue
+		}
+		if err := c.ws.Sync(); err != nil {
+			c.onError(fmt.Errorf("logger: fsync: %w", err))
+		}
+	}
+}
+
+// close останавливает фоновую горутину.
+func (c *syncCore) close() {
+	c.state.stopOnce.Do(func() { close(c.state.stop) })
+}
@@ -0,0 +1,477 @@
+package logit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы сообщений syslog.
+const (
+	SyslogRFC5424 = "rfc5424"
+	SyslogRFC3164 = "rfc3164"
+)
+
+// Разделение сообщений в потоковых соединениях (RFC 6587).
+const (
+	SyslogOctetCounting  = "octet-counting"  // "<длина> <сообщение>"; сообщение может содержать переводы строк
+	SyslogNonTransparent = "non-transparent" // сообщение и '\n'
+)
+
+// syslogSDID - идентификатор элемента структурированных данных RFC 5424 с op и traceId.
+// 32473 - номер предприятия, зарезервированный IANA для документации (RFC 5612).
+const syslogSDID = "logit@32473"
+
+// defaultSyslogTimeout - таймаут подключения по умолчанию.
+const defaultSyslogTimeout = 5 * time.Second
+
+// defaultSyslogMaxSize - размер датаграммы по умолчанию: столько по умолчанию
+// принимают rsyslog и syslog-ng.
+const defaultSyslogMaxSize = 8192
+
+// syslogSockets - пути локального сокета syslog, проверяемые по умолчанию.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogConf задает вывод в syslog (тип вывода syslog).
+type SyslogConf struct {
+	// Network - udp (по умолчанию), tcp, tls, unix или unixgram. Для unix сначала
+	// пробуется датаграммный сокет, затем потоковый.
+	Network string `yaml:"network" json:"network"`
+	// Address - host:port или путь сокета; для unix по умолчанию /dev/log.
+	Address  string   `yaml:"address" json:"address"`
+	Format   string   `yaml:"format" json:"format"`     // rfc5424 (по умолчанию) или rfc3164
+	Framing  string   `yaml:"framing" json:"framing"`   // для потоковых соединений; по умолчанию octet-counting
+	Facility string   `yaml:"facility" json:"facility"` // kern..local7; по умолчанию user
+	AppName  string   `yaml:"appName" json:"appName"`   // по умолчанию AppConf.Name
+	TLS      *TLSConf `yaml:"tls" json:"tls"`           // для network tls
+	// Timeout ограничивает подключение; по умолчанию 5s. Отправку пакета
+	// ограничивает Batch.Timeout.
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// MaxSize - максимальный размер сообщения в датаграммных соединениях (udp,
+	// unixgram); более длинные сообщения обрезаются. По умолчанию 8192 байта.
+	MaxSize int        `yaml:"maxSize" json:"maxSize"`
+	Batch   *BatchConf `yaml:"batch" json:"batch"`
+}
+
+// syslogSeverity сопоставляет уровень zap уровню важности syslog.
+func syslogSeverity(lvl zapcore.Level) int {
+	switch {
+	case lvl <= zapcore.DebugLevel:
+		return 7 // debug
+	case lvl == zapcore.InfoLevel:
+		return 6 // info
+	case lvl == zapcore.WarnLevel:
+		return 4 // warning
+	case lvl == zapcore.ErrorLevel:
+		return 3 // err
+	case lvl == zapcore.FatalLevel:
+		return 1 // alert
+	default:
+		return 2 // crit: DPanic и Panic
+	}
+}
+
+// newSyslogCore создает ядро вывода в syslog. Сообщения отправляются пакетами
+// фоновой горутиной, поэтому подключение и запись не задерживают вызовы логгера;
+// подключение выполняется при первой отправке.
+func newSyslogCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Syslog
+	if conf == nil {
+		conf = &SyslogConf{}
+	}
+
+	format := strings.ToLower(conf.Format)
+	switch format {
+	case "":
+		format = SyslogRFC5424
+	case SyslogRFC5424, SyslogRFC3164:
+	default:
+		return nil, fmt.Errorf("logger: неизвестный формат syslog %q", conf.Format)
+	}
+	facilityName := conf.Facility
+	if facilityName == "" {
+		facilityName = "user"
+	}
+	facility, ok := syslogFacilities[strings.ToLower(facilityName)]
+	if !ok {
+		return nil, fmt.Errorf("logger: неизвестный facility syslog %q", conf.Facility)
+	}
+
+	sender, err := newSyslogSender(conf, params.errorHandler())
+	if err != nil {
+		return nil, err
+	}
+
+	// Время и уровень передаются в заголовке syslog.
+	encoderConfig.TimeKey = ""
+	encoderConfig.LevelKey = ""
+	encoderConfig.LineEnding = "\n"
+	encoder, err := out.encoder(EncoderLogfmt, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+
+	appName := conf.AppName
+	if appName == "" {
+		appName = params.AppConf.Name
+	}
+	hostname, _ := os.Hostname()
+	b := newBatcher("syslog "+sender.target, conf.Batch, sender.send, params.errorHandler())
+	b.closers = append(b.closers, sender.close)
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc: &syslogEncoder{
+			Encoder: encoder,
+			header: &syslogHeader{
+				format:   format,
+				facility: facility,
+				hostname: syslogToken(hostname, 255),
+				appName:  syslogToken(appName, 48),
+				pid:      os.Getpid(),
+			},
+		},
+		key: func(zapcore.Entry, []zapcore.Field) string { return "" },
+		b:   b,
+	}, nil
+}
+
+// syslogToken приводит значение поля заголовка к печатным ASCII-символам без
+// пробелов. Пустое значение заменяется на "-".
+func syslogToken(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// syslogHeader формирует заголовок сообщения.
+type syslogHeader struct {
+	format   string
+	facility int
+	hostname string
+	appName  string
+	pid      int
+}
+
+var syslogPool = buffer.NewPool()
+
+// append пишет в buf заголовок сообщения, включая структурированные данные RFC 5424.
+func (h *syslogHeader) append(buf *buffer.Buffer, ent zapcore.Entry, op, traceID string) {
+	buf.AppendByte('<')
+	buf.AppendInt(int64(h.facility*8 + syslogSeverity(ent.Level)))
+	buf.AppendByte('>')
+
+	if h.format == SyslogRFC3164 {
+		buf.AppendString(ent.Time.Format(time.Stamp))
+		buf.AppendByte(' ')
+		buf.AppendString(h.hostname)
+		buf.AppendByte(' ')
+		tag := h.appName
+		if len(tag) > 32 {
+			tag = tag[:32]
+		}
+		buf.AppendString(tag)
+		buf.AppendByte('[')
+		buf.AppendInt(int64(h.pid))
+		buf.AppendString("]: ")
+		return
+	}
+
+	buf.AppendString("1 ")
+	buf.AppendString(ent.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.AppendByte(' ')
+	buf.AppendString(h.hostname)
+	buf.AppendByte(' ')
+	buf.AppendString(h.appName)
+	buf.AppendByte(' ')
+	buf.AppendInt(int64(h.pid))
+	buf.AppendString(" - ") // MSGID
+	if op == "" && traceID == "" {
+		buf.AppendString("- ")
+		return
+	}
+	buf.AppendString("[" + syslogSDID)
+	appendSDParam(buf, string(opKey), op)
+	appendSDParam(buf, string(traceIDKey), traceID)
+	buf.AppendString("] ")
+}
+
+// appendSDParam пишет параметр структурированных данных, экранируя '"', '\' и ']'.
+func appendSDParam(buf *buffer.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	buf.AppendByte(' ')
+	buf.AppendString(name)
+	buf.AppendString(`="`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			buf.AppendByte('\\')
+			buf.AppendByte(c)
+		default:
+			buf.AppendByte(c)
+		}
+	}
+	buf.AppendByte('"')
+}
+
+// syslogEncoder дополняет запись кодировщика вывода заголовком syslog. В формате
+// RFC 5424 op и traceId, в том числе добавленные через With, выносятся
+// в структурированные данные, остальные поля остаются в тексте сообщения.
+type syslogEncoder struct {
+	zapcore.Encoder
+	header *syslogHeader
+
+	op, traceID string // добавленные через With
+}
+
+func (e *syslogEncoder) Clone() zapcore.Encoder {
+	return &syslogEncoder{Encoder: e.Encoder.Clone(), header: e.header, op: e.op, traceID: e.traceID}
+}
+
+func (e *syslogEncoder) AddString(key, value string) {
+	if e.header.format == SyslogRFC5424 {
+		switch key {
+		case string(opKey):
+			e.op = value
+			return
+		case string(traceIDKey):
+			e.traceID = value
+			return
+		}
+	}
+	e.Encoder.AddString(key, value)
+}
+
+func (e *syslogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	op, traceID, fields := e.structured(fields)
+	body, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	msg := syslogPool.Get()
+	e.header.append(msg, ent, op, traceID)
+	_, _ = msg.Write(bytes.TrimRight(body.Bytes(), "\n"))
+	body.Free()
+	return msg, nil
+}
+
+// structured отделяет op и traceId для структурированных данных RFC 5424.
+// В формате RFC 3164 поля не изменяются.
+func (e *syslogEncoder) structured(fields []zapcore.Field) (op, traceID string, rest []zapcore.Field) {
+	op, traceID = e.op, e.traceID
+	if e.header.format != SyslogRFC5424 {
+		return op, traceID, fields
+	}
+	rest = fields[:0:0]
+	for _, f := range fields {
+		if f.Type == zapcore.StringType {
+			switch f.Key {
+			case string(opKey):
+				op = f.String
+				continue
+			case string(traceIDKey):
+				traceID = f.String
+				continue
+			}
+		}
+		rest = append(rest, f)
+	}
+	return op, traceID, rest
+}
+
+// syslogSender отправляет пакеты сообщений в одно соединение; используется
+// только горутиной batcher.
+type syslogSender struct {
+	dial    func(ctx context.Context) (net.Conn, bool, error) // соединение и признак потокового соединения
+	framing string
+	target  string
+	maxSize int // размер датаграммы
+	onError func(error)
+
+	conn   net.Conn
+	stream bool
+}
+
+func newSyslogSender(conf *SyslogConf, onError func(error)) (*syslogSender, error) {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultSyslogTimeout
+	}
+	maxSize := conf.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultSyslogMaxSize
+	}
+	framing := strings.ToLower(conf.Framing)
+	switch framing {
+	case "":
+		framing = SyslogOctetCounting
+	case SyslogOctetCounting, SyslogNonTransparent:
+	default:
+		return nil, fmt.Errorf("logger: неизвестный способ разделения сообщений syslog %q", conf.Framing)
+	}
+
+	network := strings.ToLower(conf.Network)
+	if network == "" {
+		network = "udp"
+	}
+	address := conf.Address
+	dialer := &net.Dialer{Timeout: timeout}
+	var dial func(ctx context.Context) (net.Conn, bool, error)
+	switch network {
+	case "udp", "tcp":
+		if address == "" {
+			return nil, fmt.Errorf("logger: для syslog по %s нужен адрес (address)", network)
+		}
+		dial = func(ctx context.Context) (net.Conn, bool, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			return conn, network == "tcp", err
+		}
+	case "tls":
+		if address == "" {
+			return nil, errors.New("logger: для syslog по tls нужен адрес (address)")
+		}
+		tlsConfig, err := conf.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		dial = func(ctx context.Context) (net.Conn, bool, error) {
+			conn, err := tlsDialer.DialContext(ctx, "tcp", address)
+			return conn, true, err
+		}
+	case "unix", "unixgram":
+		addresses := syslogSockets
+		if address != "" {
+			addresses = []string{address}
+		}
+		networks := []string{"unixgram", "unix"}
+		if network == "unixgram" {
+			networks = networks[:1]
+		}
+		dial = func(ctx context.Context) (net.Conn, bool, error) {
+			var lastErr error
+			for _, addr := range addresses {
+				for _, n := range networks {
+					conn, err := dialer.DialContext(ctx, n, addr)
+					if err == nil {
+						return conn, n == "unix", nil
+					}
+					lastErr = err
+				}
+			}
+			return nil, false, lastErr
+		}
+	default:
+		return nil, fmt.Errorf("logger: неизвестный сетевой протокол syslog %q", conf.Network)
+	}
+
+	return &syslogSender{
+		dial:    dial,
+		framing: framing,
+		target:  network + "://" + address,
+		maxSize: maxSize,
+		onError: onError,
+	}, nil
+}
+
+// send отправляет пакет. В датаграммных соединениях каждое сообщение - отдельная
+// датаграмма не длиннее maxSize, и после ошибки повторяются только неотправленные;
+// сообщение, которое система отвергла как слишком длинное, отбрасывается, так как
+// повтор не поможет. В потоковых соединениях сообщения разделяются по RFC 6587
+// и пишутся одной записью.
+func (s *syslogSender) send(ctx context.Context, batch []remoteEntry) error {
+	if s.conn == nil {
+		conn, stream, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn, s.stream = conn, stream
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+
+	if !s.stream {
+		for i, e := range batch {
+			msg := truncateUTF8(e.data, s.maxSize)
+			if _, err := s.conn.Write(msg); err != nil {
+				if errors.Is(err, syscall.EMSGSIZE) {
+					s.onError(fmt.Errorf("logger: syslog %s: сообщение (%d байт) не помещается в датаграмму, отброшено: %w", s.target, len(msg), err))
+					continue
+				}
+				return &partialError{entries: batch[i:], err: s.fail(err)}
+			}
+		}
+		return nil
+	}
+	var frames []byte
+	for _, e := range batch {
+		if s.framing == SyslogOctetCounting {
+			frames = strconv.AppendInt(frames, int64(len(e.data)), 10)
+			frames = append(frames, ' ')
+			frames = append(frames, e.data...)
+		} else {
+			frames = append(append(frames, e.data...), '\n')
+		}
+	}
+	if _, err := s.conn.Write(frames); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// truncateUTF8 обрезает data до max байт, не разрывая символ UTF-8.
+func truncateUTF8(data []byte, max int) []byte {
+	if len(data) <= max {
+		return data
+	}
+	end := max
+	for end > 0 && end > max-utf8.UTFMax && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return data[:end]
+}
+
+func (s *syslogSender) fail(err error) error {
+	_ = s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// close закрывает соединение после остановки batcher.
+func (s *syslogSender) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,414 @@
+package logit
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newSyslogTestLogger создает логгер с единственным выводом syslog.
+func newSyslogTestLogger(t *testing.T, conf *SyslogConf) Logger {
+	t.Helper()
+	conf.Batch = testBatchConf()
+	return newOutputTestLogger(t, OutputConf{Type: OutputSyslog, Syslog: conf})
+}
+
+// syslogTestContext возвращает контекст с op и traceId.
+func syslogTestContext(l Logger) context.Context {
+	traceID := "trace-1"
+	return l.NewCtx(context.Background(), "op-1", &traceID)
+}
+
+// syslogServer принимает потоковые соединения и передает в messages
+// сообщения, разделенные по framing. После первого сообщения соединения
+// закрываются, если closeAfterFirst.
+type syslogServer struct {
+	ln       net.Listener
+	framing  string
+	messages chan string
+	conns    chan int // номер соединения, через которое пришло сообщение
+}
+
+func newSyslogServer(t *testing.T, ln net.Listener, framing string, closeAfterFirst bool) *syslogServer {
+	t.Helper()
+	s := &syslogServer{ln: ln, framing: framing, messages: make(chan string, 100), conns: make(chan int, 100)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for n := 1; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, n, closeAfterFirst)
+		}
+	}()
+	return s
+}
+
+func (s *syslogServer) serve(conn net.Conn, n int, closeAfterFirst bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var msg string
+		if s.framing == SyslogNonTransparent {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			msg = strings.TrimSuffix(line, "\n")
+		} else {
+			prefix, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+			if err != nil {
+				return
+			}
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			msg = string(buf)
+		}
+		s.conns <- n
+		s.messages <- msg
+		if closeAfterFirst {
+			return
+		}
+	}
+}
+
+func receiveSyslog(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("сообщение syslog не получено")
+		return ""
+	}
+}
+
+func checkSyslogMessage(t *testing.T, msg, prefix string, parts ...string) {
+	t.Helper()
+	if !strings.HasPrefix(msg, prefix) {
+		t.Errorf("сообщение %q не начинается с %q", msg, prefix)
+	}
+	for _, part := range parts {
+		if !strings.Contains(msg, part) {
+			t.Errorf("в сообщении %q нет %q", msg, part)
+		}
+	}
+}
+
+const syslogTestSD = `[logit@32473 op="op-1" traceId="trace-1"] `
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "udp", Address: pc.LocalAddr().String(), Facility: "local0"})
+	ctx := syslogTestContext(l)
+	for i := 0; i < 3; i++ {
+		l.Info(ctx, "hello", zap.Int("n", i))
+	}
+	l.Warn(ctx, "second line\nof warning")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	buf := make([]byte, 64<<10)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 4; i++ {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("датаграмма %d: %v", i, err)
+		}
+		msg := string(buf[:n])
+		if i < 3 {
+			// local0 (16) * 8 + info (6)
+			checkSyslogMessage(t, msg, "<134>1 ", " app ", syslogTestSD, "msg=hello", fmt.Sprintf("n=%d", i))
+		} else {
+			// local0 (16) * 8 + warning (4)
+			checkSyslogMessage(t, msg, "<132>1 ", syslogTestSD, `msg="second line\nof warning"`)
+		}
+	}
+}
+
+func TestSyslogUDPTruncatesLongMessages(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "udp", Address: pc.LocalAddr().String(), MaxSize: 256})
+	ctx := syslogTestContext(l)
+	l.Info(ctx, strings.Repeat("я", 1000))
+	l.Info(ctx, "short")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	buf := make([]byte, 64<<10)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i, want := range []string{`msg="яя`, "msg=short"} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("датаграмма %d: %v", i, err)
+		}
+		if n > 256 || !utf8.Valid(buf[:n]) || !strings.Contains(string(buf[:n]), want) {
+			t.Errorf("датаграмма %d (%d байт): %q", i, n, buf[:n])
+		}
+	}
+}
+
+// msgSizeConn - датаграммное соединение, отвергающее записи длиннее limit.
+type msgSizeConn struct {
+	net.Conn
+	limit   int
+	written []string
+}
+
+func (c *msgSizeConn) Write(p []byte) (int, error) {
+	if len(p) > c.limit {
+		return 0, &net.OpError{Op: "write", Net: "unixgram", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)}
+	}
+	c.written = append(c.written, string(p))
+	return len(p), nil
+}
+
+func (c *msgSizeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestSyslogDropsOversizedDatagram(t *testing.T) {
+	conn := &msgSizeConn{limit: 16}
+	var errs []error
+	s, err := newSyslogSender(&SyslogConf{Network: "unixgram"}, func(err error) { errs = append(errs, err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.dial = func(context.Context) (net.Conn, bool, error) { return conn, false, nil }
+
+	batch := []remoteEntry{{data: []byte("first")}, {data: []byte(strings.Repeat("x", 100))}, {data: []byte("third")}}
+	if err := s.send(context.Background(), batch); err != nil {
+		t.Fatalf("send: %v, ожидалась отправка остальных сообщений", err)
+	}
+	if strings.Join(conn.written, ",") != "first,third" {
+		t.Errorf("отправлено %q", conn.written)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], syscall.EMSGSIZE) {
+		t.Errorf("ошибки %v, ожидалась одна EMSGSIZE", errs)
+	}
+}
+
+func TestSyslogTCPOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newSyslogServer(t, ln, SyslogOctetCounting, false)
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "tcp", Address: ln.Addr().String()})
+	ctx := syslogTestContext(l)
+	l.Error(ctx, fmt.Errorf("boom"))
+	l.Info(ctx, "multi\nline")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// user (1) * 8 + err (3)
+	checkSyslogMessage(t, receiveSyslog(t, srv.messages), "<11>1 ", syslogTestSD, "msg=boom")
+	checkSyslogMessage(t, receiveSyslog(t, srv.messages), "<14>1 ", syslogTestSD, `msg="multi\nline"`)
+}
+
+func TestSyslogTCPNonTransparentRFC3164(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newSyslogServer(t, ln, SyslogNonTransparent, false)
+
+	l := newSyslogTestLogger(t, &SyslogConf{
+		Network: "tcp", Address: ln.Addr().String(), Framing: SyslogNonTransparent, Format: SyslogRFC3164, AppName: "my app",
+	})
+	l.Info(syslogTestContext(l), "hello")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	msg := receiveSyslog(t, srv.messages)
+	checkSyslogMessage(t, msg, "<14>", fmt.Sprintf(" my_app[%d]: ", os.Getpid()), "msg=hello", "op=op-1", "traceId=trace-1")
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert, caFile := newTestCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newSyslogServer(t, ln, SyslogOctetCounting, false)
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "tls", Address: ln.Addr().String(), TLS: &TLSConf{CAFile: caFile}})
+	l.Info(syslogTestContext(l), "secure")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	checkSyslogMessage(t, receiveSyslog(t, srv.messages), "<14>1 ", syslogTestSD, "msg=secure")
+}
+
+func TestSyslogReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newSyslogServer(t, ln, SyslogOctetCounting, true)
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "tcp", Address: ln.Addr().String()})
+	ctx := context.Background()
+	l.Info(ctx, "first")
+	_ = Sync(l)
+	checkSyslogMessage(t, receiveSyslog(t, srv.messages), "<14>1 ", "msg=first")
+	if n := <-srv.conns; n != 1 {
+		t.Fatalf("первое сообщение пришло через соединение %d", n)
+	}
+
+	// Сервер закрыл соединение. Первая запись в закрытое соединение может пройти
+	// без ошибки, поэтому пишем, пока сообщение не придет через новое соединение.
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; time.Now().Before(deadline); i++ {
+		l.Info(ctx, fmt.Sprintf("retry %d", i))
+		_ = Sync(l)
+		select {
+		case msg := <-srv.messages:
+			if n := <-srv.conns; n < 2 {
+				t.Fatalf("сообщение %q пришло через старое соединение", msg)
+			}
+			checkSyslogMessage(t, msg, "<14>1 ", "msg=\"retry ")
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("после закрытия соединения сообщения не доставлены")
+}
+
+func TestSyslogDoesNotBlockLogging(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Сервер принимает соединения, но ничего не читает: отправка упирается в буферы.
+	conns := make(chan net.Conn, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	l := newSyslogTestLogger(t, &SyslogConf{Network: "tcp", Address: ln.Addr().String()})
+	payload := strings.Repeat("x", 64<<10)
+	start := time.Now()
+	for i := 0; i < 200; i++ {
+		l.Info(context.Background(), "big", zap.String("payload", payload))
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("200 записей заняли %s: отправка блокирует вызовы логгера", elapsed)
+	}
+}
+
+func TestSyslogEncoderWithFields(t *testing.T) {
+	enc := &syslogEncoder{
+		Encoder: NewLogfmtEncoder(zapcore.EncoderConfig{MessageKey: "msg"}),
+		header:  &syslogHeader{format: SyslogRFC5424, facility: 1, hostname: "host", appName: "app", pid: 1},
+	}
+	child := enc.Clone()
+	// op и traceId, добавленные через With, выносятся в структурированные данные
+	// и не попадают в текст; у родителя их нет.
+	zap.String("op", "with-op").AddTo(child)
+	zap.String("traceId", "with-trace").AddTo(child)
+	zap.String("k", "v").AddTo(child)
+
+	ent := zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Unix(0, 0).UTC(), Message: "m"}
+	buf, err := child.EncodeEntry(ent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<14>1 1970-01-01T00:00:00.000000Z host app 1 - [logit@32473 op="with-op" traceId="with-trace"] msg=m k=v`
+	if got := buf.String(); got != want {
+		t.Errorf("дочерний кодировщик:\n%s\nожидалось\n%s", got, want)
+	}
+	// Поле записи имеет приоритет над полем из With.
+	buf, err = child.EncodeEntry(ent, []zapcore.Field{zap.String("op", "entry-op")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `op="entry-op" traceId="with-trace"`) {
+		t.Errorf("op записи не вынесен: %s", buf.String())
+	}
+	buf, err = enc.EncodeEntry(ent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<14>1 1970-01-01T00:00:00.000000Z host app 1 - - msg=m"; buf.String() != want {
+		t.Errorf("родитель: %s, ожидалось %s", buf.String(), want)
+	}
+}
+
+// newTestCertificate создает самоподписанный сертификат для 127.0.0.1 и
+// возвращает его и путь к PEM-файлу для TLSConf.CAFile.
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "logit test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,128 @@
+package logit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strings"
+)
+
+const defaultWebhookDeadLetterFile = "webhook-deadletter.log"
+
+// Формат тела запроса webhook.
+const (
+	WebhookNDJSON = "ndjson" // запись на строку
+	WebhookArray  = "array"  // массив JSON
+)
+
+// WebhookConf задает отправку пакетов записей POST-запросом на произвольный
+// HTTP-адрес (тип вывода webhook).
+type WebhookConf struct {
+	URL     string            `yaml:"url" json:"url"`
+	Format  string            `yaml:"format" json:"format"` // ndjson (по умолчанию) или array
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Gzip    bool              `yaml:"gzip" json:"gzip"` // сжатие тела, Content-Encoding: gzip
+	TLS     *TLSConf          `yaml:"tls" json:"tls"`
+	Batch   *BatchConf        `yaml:"batch" json:"batch"`
+	// DeadLetterFile - файл (относительно LoggerConf.Dir), в который пишутся пакеты,
+	// не отправленные после всех повторов или отклоненные с кодом 4xx;
+	// по умолчанию webhook-deadletter.log.
+	DeadLetterFile string `yaml:"deadLetterFile" json:"deadLetterFile"`
+}
+
+// newWebhookCore создает ядро отправки пакетов на HTTP-адрес. Записи кодируются
+// кодировщиком json (допустим профиль); ответ 2xx считается успехом, 408, 429
+// и 5xx повторяются с растущей паузой.
+func newWebhookCore(params *Params, out OutputConf, encoderConfig zapcore.EncoderConfig) (zapcore.Core, error) {
+	conf := out.Webhook
+	if conf == nil || conf.URL == "" {
+		return nil, fmt.Errorf("logger: для вывода %q нужен адрес (url)", OutputWebhook)
+	}
+	if out.Encoder != "" && !strings.EqualFold(out.Encoder, EncoderJSON) {
+		return nil, fmt.Errorf("logger: вывод %q поддерживает только кодировщик json", OutputWebhook)
+	}
+	hook := &webhook{url: conf.URL, gzip: conf.Gzip, header: http.Header{}}
+	switch strings.ToLower(conf.Format) {
+	case "", WebhookNDJSON:
+		hook.header.Set("Content-Type", "application/x-ndjson")
+	case WebhookArray:
+		hook.array = true
+		hook.header.Set("Content-Type", "application/json")
+	default:
+		return nil, fmt.Errorf("logger: неизвестный формат webhook %q", conf.Format)
+	}
+	for k, v := range conf.Headers {
+		hook.header.Set(k, v)
+	}
+	if conf.Gzip {
+		hook.header.Set("Content-Encoding", "gzip")
+	}
+
+	var err error
+	if hook.client, err = httpClient(conf.TLS, 0); err != nil {
+		return nil, err
+	}
+	encoder, err := out.encoder(EncoderJSON, encoderConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	b := newBatcher("webhook "+conf.URL, conf.Batch, hook.send, params.errorHandler())
+	b.closers = append(b.closers, closeIdle(hook.client))
+	deadLetterFile := conf.DeadLetterFile
+	if deadLetterFile == "" {
+		deadLetterFile = defaultWebhookDeadLetterFile
+	}
+	if err := b.setFallbackFile(params, deadLetterFile); err != nil {
+		_ = b.close()
+		return nil, err
+	}
+	return &remoteCore{
+		LevelEnabler: out.levelEnabler(),
+		enc:          encoder,
+		key:          func(zapcore.Entry, []zapcore.Field) string { return "" },
+		b:            b,
+	}, nil
+}
+
+// webhook отправляет пакеты одним запросом.
+type webhook struct {
+	url    string
+	client *http.Client
+	header http.Header
+	array  bool
+	gzip   bool
+}
+
+func (h *webhook) send(ctx context.Context, batch []remoteEntry) error {
+	var body []byte
+	if h.array {
+		body = append(body, '[')
+	}
+	for i, e := range batch {
+		if h.array && i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, e.data...)
+		if !h.array {
+			body = append(body, '\n')
+		}
+	}
+	if h.array {
+		body = append(body, ']')
+	}
+
+	if h.gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(body)
+		if err := w.Close(); err != nil {
+			return &permanentError{err}
+		}
+		body = buf.Bytes()
+	}
+	_, err := postHTTP(ctx, h.client, h.url, h.header, body)
+	return err
+}
@@ -0,0 +1,174 @@
+package logit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newWebhookTestLogger(t *testing.T, conf *WebhookConf) (Logger, string) {
+	t.Helper()
+	if conf.Batch == nil {
+		conf.Batch = testBatchConf()
+	}
+	params := newOutputTestParams(t, OutputConf{Type: OutputWebhook, Webhook: conf})
+	params.ErrorHandler = func(error) {}
+	return newParamsTestLogger(t, params), filepath.Join(params.LoggerConf.Dir, defaultWebhookDeadLetterFile)
+}
+
+// webhookMessages возвращает поле msg записей из тела запроса в формате NDJSON
+// или массива JSON.
+func webhookMessages(t *testing.T, body []byte) []string {
+	t.Helper()
+	var docs []map[string]any
+	if bytes.HasPrefix(body, []byte("[")) {
+		if err := json.Unmarshal(body, &docs); err != nil {
+			t.Fatalf("тело %q: %v", body, err)
+		}
+	} else {
+		for _, line := range bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n")) {
+			var doc map[string]any
+			if err := json.Unmarshal(line, &doc); err != nil {
+				t.Fatalf("строка %q: %v", line, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	var msgs []string
+	for _, doc := range docs {
+		msgs = append(msgs, doc["msg"].(string))
+	}
+	return msgs
+}
+
+func TestWebhookBodyFormats(t *testing.T) {
+	for _, tt := range []struct {
+		format      string
+		contentType string
+	}{
+		{"", "application/x-ndjson"},
+		{WebhookArray, "application/json"},
+	} {
+		t.Run("format="+tt.format, func(t *testing.T) {
+			srv := newRecordingServer(t)
+			l, _ := newWebhookTestLogger(t, &WebhookConf{
+				URL:     srv.URL + "/hook",
+				Format:  tt.format,
+				Headers: map[string]string{"Authorization": "Bearer token", "X-Source": "app"},
+			})
+			logMessages(l, "a", "b")
+			if err := Sync(l); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+
+			reqs := srv.recorded()
+			if len(reqs) != 1 {
+				t.Fatalf("запросов: %d, ожидался один", len(reqs))
+			}
+			r := reqs[0]
+			if r.path != "/hook" {
+				t.Errorf("путь %q", r.path)
+			}
+			if ct := r.header.Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Content-Type %q, ожидался %q", ct, tt.contentType)
+			}
+			if r.header.Get("Authorization") != "Bearer token" || r.header.Get("X-Source") != "app" {
+				t.Errorf("заголовки %v без заданных в Headers", r.header)
+			}
+			if got := strings.Join(webhookMessages(t, r.body), ","); got != "a,b" {
+				t.Errorf("в теле %q, ожидались a,b", got)
+			}
+		})
+	}
+}
+
+func TestWebhookGzip(t *testing.T) {
+	srv := newRecordingServer(t)
+	l, _ := newWebhookTestLogger(t, &WebhookConf{URL: srv.URL, Format: WebhookArray, Gzip: true})
+	logMessages(l, "zipped")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 1 {
+		t.Fatalf("запросов: %d, ожидался один", len(reqs))
+	}
+	if ce := reqs[0].header.Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("Content-Encoding %q, ожидался gzip", ce)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(reqs[0].body))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if got := strings.Join(webhookMessages(t, body), ","); got != "zipped" {
+		t.Errorf("в теле %q, ожидалось zipped", got)
+	}
+}
+
+func TestWebhookRetriesTransientErrors(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	l, deadLetter := newWebhookTestLogger(t, &WebhookConf{URL: srv.URL})
+	logMessages(l, "retried")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	reqs := srv.recorded()
+	if len(reqs) != 4 {
+		t.Fatalf("запросов: %d, ожидалось 3 ошибки и успешный повтор", len(reqs))
+	}
+	for _, r := range reqs {
+		if got := strings.Join(webhookMessages(t, r.body), ","); got != "retried" {
+			t.Errorf("в теле %q, ожидался тот же пакет", got)
+		}
+	}
+	if msgs := fallbackMessages(t, deadLetter); len(msgs) != 0 {
+		t.Errorf("в dead-letter файле %v", msgs)
+	}
+}
+
+func TestWebhookRejectedBatchGoesToDeadLetter(t *testing.T) {
+	srv := newRecordingServer(t, http.StatusBadRequest)
+	l, deadLetter := newWebhookTestLogger(t, &WebhookConf{URL: srv.URL})
+	logMessages(l, "a", "b")
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if n := len(srv.recorded()); n != 1 {
+		t.Errorf("запросов: %d, ответ 400 не должен повторяться", n)
+	}
+	if got := strings.Join(fallbackMessages(t, deadLetter), ","); got != "a,b" {
+		t.Errorf("в dead-letter файле %q, ожидался весь пакет", got)
+	}
+}
+
+func TestWebhookStatsQueueDepth(t *testing.T) {
+	srv := newRecordingServer(t)
+	l, _ := newWebhookTestLogger(t, &WebhookConf{URL: srv.URL})
+	logMessages(l, "a", "b", "c")
+
+	stats := Stats(l)
+	if len(stats) != 1 || stats[0].Entries != 3 || stats[0].Bytes == 0 {
+		t.Fatalf("до отправки %+v, ожидались 3 записи в очереди", stats)
+	}
+	if !strings.Contains(stats[0].Name, srv.URL) {
+		t.Errorf("имя очереди %q без адреса", stats[0].Name)
+	}
+	if err := Sync(l); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if stats := Stats(l); stats[0].Entries != 0 || stats[0].Bytes != 0 || stats[0].Dropped != 0 {
+		t.Errorf("после отправки %+v, ожидалась пустая очередь", stats[0])
+	}
+}